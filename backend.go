@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"golox/pkg/compiler"
+	"golox/pkg/fault"
+	"golox/pkg/interpreter"
+	"golox/pkg/parser"
+	"golox/pkg/resolver"
+	"golox/pkg/vm"
+)
+
+// backend runs resolved programs. Implementations keep their global state
+// between calls so the REPL can feed them one line at a time. When echo is
+// set, the value of a final expression statement is printed unless it is
+// nil.
+type backend interface {
+	run(stmts []parser.Stmt, res *resolver.Resolution, echo bool) (int, error)
+
+	// globals returns the names of the global variables in alphabetical
+	// order and global formats the value of one of them.
+	globals() []string
+	global(name string) string
+}
+
+type treeBackend struct {
+	i *interpreter.Interpreter
+}
+
+func (b *treeBackend) run(stmts []parser.Stmt, res *resolver.Resolution, echo bool) (int, error) {
+	value, err := b.i.Eval(stmts, res)
+	if err != nil {
+		// compile errors in an imported module
+		if _, ok := err.(fault.List); ok {
+			return EXIT_COMPILE, err
+		}
+		return EXIT_RUNTIME, err
+	}
+
+	if echo && value != nil {
+		fmt.Println(interpreter.Stringify(value))
+	}
+
+	return 0, nil
+}
+
+func (b *treeBackend) globals() []string {
+	return b.i.Globals()
+}
+
+func (b *treeBackend) global(name string) string {
+	value, _ := b.i.Global(name)
+	return interpreter.Stringify(value)
+}
+
+type vmBackend struct {
+	vm *vm.VM
+}
+
+func (b *vmBackend) run(stmts []parser.Stmt, res *resolver.Resolution, echo bool) (int, error) {
+	fn, err := compiler.NewCompiler().Compile(stmts, res)
+	if err != nil {
+		return EXIT_COMPILE, err
+	}
+
+	value, err := b.vm.Eval(fn)
+	if err != nil {
+		return EXIT_RUNTIME, err
+	}
+
+	if echo && value != nil {
+		fmt.Println(vm.Stringify(value))
+	}
+
+	return 0, nil
+}
+
+func (b *vmBackend) globals() []string {
+	return b.vm.Globals()
+}
+
+func (b *vmBackend) global(name string) string {
+	value, _ := b.vm.Global(name)
+	return vm.Stringify(value)
+}
+
+// newBackend creates the backend called name. path is the script that is
+// run, which relative imports are resolved against, or empty for the REPL.
+// Scripts can read their command line arguments with argc() and arg(index),
+// or as a list with args() where there are lists, read environment variables
+// with getenv(name) and end the process with exit([status]), which calls
+// exit.
+func newBackend(name string, path string, args []string, exit func(status int)) backend {
+	argc := func([]interface{}) (interface{}, error) {
+		return float64(len(args)), nil
+	}
+
+	if name == "vm" {
+		v := vm.NewVM()
+		v.DefineNative("argc", 0, argc)
+		v.DefineNative("arg", 1, argNative(args))
+		v.DefineNative("getenv", 1, getenv)
+		v.DefineNative("exit", -1, exitNative(exit))
+		return &vmBackend{v}
+	}
+
+	i := interpreter.NewInterpreter()
+	i.DefineNative(interpreter.NewNativeFunc("args", 0, func([]interface{}) (interface{}, error) {
+		return interpreter.ToLox(args), nil
+	}))
+	i.DefineNative(interpreter.NewNativeFunc("argc", 0, argc))
+	i.DefineNative(interpreter.NewNativeFunc("arg", 1, argNative(args)))
+	i.DefineNative(interpreter.NewNativeFunc("getenv", 1, getenv))
+	i.DefineNative(interpreter.NewNativeFunc("exit", -1, exitNative(exit)))
+	i.SetModulePath(filepath.SplitList(os.Getenv("LOXPATH")))
+	i.SetModuleReader(readSource)
+	if path != "" {
+		i.SetPath(path)
+	}
+	return &treeBackend{i}
+}
+
+// argNative returns the native that gets the command line argument at an
+// index.
+func argNative(args []string) func(args []interface{}) (interface{}, error) {
+	return func(index []interface{}) (interface{}, error) {
+		n, ok := index[0].(float64)
+		if !ok || n != math.Trunc(n) || n < 0 || n >= float64(len(args)) {
+			return nil, fmt.Errorf("argument index must be an integer between 0 and argc() - 1")
+		}
+
+		return args[int(n)], nil
+	}
+}
+
+// getenv returns the value of an environment variable, or nil if it is not
+// set.
+func getenv(args []interface{}) (interface{}, error) {
+	name, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("environment variable name must be a string")
+	}
+
+	if value, ok := os.LookupEnv(name); ok {
+		return value, nil
+	}
+
+	return nil, nil
+}
+
+func exitNative(exit func(status int)) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if len(args) > 1 {
+			return nil, fmt.Errorf("expected 0 or 1 arguments but got %d", len(args))
+		}
+
+		status := 0.0
+		if len(args) == 1 {
+			n, ok := args[0].(float64)
+			if !ok || n != math.Trunc(n) || n < 0 || n > 255 {
+				return nil, fmt.Errorf("exit status must be an integer between 0 and 255")
+			}
+			status = n
+		}
+
+		exit(int(status))
+		return nil, nil
+	}
+}
@@ -0,0 +1,16 @@
+#!/bin/sh
+# Runs every benchmark on both backends and prints its result together with
+# the wall clock time it took in milliseconds. To compare tree interpreter
+# changes, use go test -bench . ./pkg/interpreter, which runs the same scripts.
+set -e
+cd "$(dirname "$0")/.."
+go build -o /tmp/golox-bench .
+for script in bench/*.lox; do
+	for backend in tree vm; do
+		start=$(date +%s%N)
+		result=$(/tmp/golox-bench -backend "$backend" "$script")
+		end=$(date +%s%N)
+		ms=$(((end - start) / 1000000))
+		printf '%-18s %-4s %10s %5d ms\n' "$script" "$backend" "$result" "$ms"
+	done
+done
@@ -1,3 +1,7 @@
 module golox
 
-go 1.22.3
\ No newline at end of file
+go 1.22.3
+
+require github.com/peterh/liner v1.2.2
+
+require github.com/mattn/go-runewidth v0.0.3 // indirect
@@ -1,85 +1,441 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"strings"
 
-	"golox/pkg/interpreter"
+	"golox/pkg/fault"
+	"golox/pkg/format"
+	"golox/pkg/golox"
 	"golox/pkg/parser"
+	"golox/pkg/printer"
 	"golox/pkg/resolver"
 	"golox/pkg/scanner"
 )
 
+// Exit statuses follow the BSD sysexits convention.
+const (
+	EXIT_OK      = 0
+	EXIT_USAGE   = 64
+	EXIT_COMPILE = 65
+	EXIT_NOINPUT = 66
+	EXIT_RUNTIME = 70
+	EXIT_IO      = 74
+)
+
+// STDIN names the standard input in diagnostics.
+const STDIN = "<stdin>"
+
+type command struct {
+	name string
+	args string
+	help string
+	run  func(fs *flag.FlagSet, args []string) int
+}
+
+var subcommands []command
+
+func init() {
+	subcommands = []command{
+		{"run", "[-e code | script | -] [arguments]", "run a script, the code given with -e or the standard input", runCommand},
+		{"check", "files...", "scan, parse and resolve files without running them", checkCommand},
+		{"tokens", "[-e code | file | -]", "print the tokens of a program", tokensCommand},
+		{"ast", "[-json] [-e code | file | -]", "print the syntax tree of a program as S-expressions or JSON", astCommand},
+		{"fmt", "[-w] files...", "print files in the canonical format, or rewrite them with -w", fmtCommand},
+		{"repl", "", "start an interactive session", replCommand},
+		{"help", "[command]", "show help for golox or one of its commands", helpCommand},
+	}
+}
+
+var (
+	reporter fault.Reporter
+	sources  = fault.Sources{}
+
+	backendName       = "tree"
+	diagnosticsFormat = "text"
+)
+
 func main() {
-	if len(os.Args) > 2 {
-		log.Fatal("Usage golox [script]")
-	} else if len(os.Args) == 2 {
-		runFile(os.Args[1])
-	} else {
-		runPrompt()
+	fs := newFlagSet("golox")
+	fs.Usage = func() { usage(fs.Output()) }
+	if code, ok := parseFlags(fs, os.Args[1:]); !ok {
+		os.Exit(code)
+	}
+
+	args := fs.Args()
+	if len(args) == 0 {
+		os.Exit(replCommand(newFlagSet("repl"), nil))
+	}
+
+	// golox script is short for golox run script
+	c, rest := subcommands[0], args
+	for _, sub := range subcommands {
+		if sub.name == args[0] {
+			c, rest = sub, args[1:]
+		}
+	}
+
+	cfs := newFlagSet(c.name)
+	cfs.Usage = func() { commandUsage(cfs, c) }
+	os.Exit(c.run(cfs, rest))
+}
+
+// newFlagSet creates the flags of a command, all of which accept the flags
+// choosing the backend and the format of diagnostics.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&backendName, "backend", backendName, "execution backend: tree or vm")
+	fs.StringVar(&diagnosticsFormat, "diagnostics", diagnosticsFormat, "error output format: text, short or json")
+	return fs
+}
+
+// parseFlags parses the flags of a command and sets up the reporter. It
+// reports false with the exit status when the command should not go on,
+// because of a usage error or because help was asked for.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return EXIT_OK, false
+	} else if err != nil {
+		return EXIT_USAGE, false
+	}
+
+	switch diagnosticsFormat {
+	case "text":
+		reporter = fault.NewSnippetReporter(os.Stderr, sources)
+	case "short":
+		reporter = fault.NewTextReporter(os.Stderr)
+	case "json":
+		reporter = fault.NewJSONReporter(os.Stderr)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown diagnostics format %s\n", diagnosticsFormat)
+		return EXIT_USAGE, false
+	}
+
+	if backendName != "tree" && backendName != "vm" {
+		fmt.Fprintf(os.Stderr, "unknown backend %s\n", backendName)
+		return EXIT_USAGE, false
+	}
+
+	return EXIT_OK, true
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: golox [flags] [command] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range subcommands {
+		fmt.Fprintf(w, "  %-40s %s\n", strings.TrimSpace(c.name+" "+c.args), c.help)
 	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "golox script is short for golox run script, and golox without arguments")
+	fmt.Fprintln(w, "starts the REPL. Every command accepts these flags:")
+	flags := newFlagSet("golox")
+	flags.SetOutput(w)
+	flags.PrintDefaults()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Imported modules are searched next to the importing file and then in the")
+	fmt.Fprintln(w, "directories listed in LOXPATH.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Scripts read their arguments with argc() and arg(index), or as a list with")
+	fmt.Fprintln(w, "args() on the tree backend, and environment variables with getenv(name).")
+	fmt.Fprintln(w, "The exit status is the one passed to exit(status) if the script calls it,")
+	fmt.Fprintln(w, "and otherwise 0 on success, 64 for usage errors, 65 for syntax and")
+	fmt.Fprintln(w, "resolution errors, 66 for unreadable input and 70 for runtime errors,")
+	fmt.Fprintln(w, "including uncaught throws.")
+}
+
+func commandUsage(fs *flag.FlagSet, c command) {
+	fmt.Fprintf(fs.Output(), "Usage: golox %s\n\n", strings.TrimSpace(c.name+" [flags] "+c.args))
+	fmt.Fprintf(fs.Output(), "%s.\n\n", strings.ToUpper(c.help[:1])+c.help[1:])
+	fs.PrintDefaults()
 }
 
-func runFile(path string) {
+// readSource reads a script or module and keeps it for the reporter to quote.
+func readSource(path string) ([]byte, error) {
 	bytes, err := os.ReadFile(path)
-	if err != nil {
-		log.Fatal(err)
+	if err == nil {
+		sources[path] = string(bytes)
 	}
 
-	stmts, err := scanAndParse(string(bytes))
-	if err != nil {
-		os.Exit(65)
+	return bytes, err
+}
+
+// readInput reads the program named on the command line, where - stands for
+// the standard input. It returns the name to use in diagnostics.
+func readInput(path string) (string, string, error) {
+	if path != "-" {
+		bytes, err := readSource(path)
+		return path, string(bytes), err
 	}
 
-	i := interpreter.NewInterpreter()
-	r := resolver.NewResolver(i)
-	err = r.Resolve(stmts)
+	bytes, err := io.ReadAll(os.Stdin)
+	sources[STDIN] = string(bytes)
+	return STDIN, string(bytes), err
+}
+
+// input finds the program for the commands that take one: the code given
+// with -e, or else the single file or - in args. It returns false with an
+// exit status if there is none.
+func input(fs *flag.FlagSet, code string, args []string) (string, string, int, bool) {
+	if code != "" {
+		if len(args) > 0 {
+			fs.Usage()
+			return "", "", EXIT_USAGE, false
+		}
+		sources[""] = code
+		return "", code, EXIT_OK, true
+	}
+
+	if len(args) != 1 {
+		fs.Usage()
+		return "", "", EXIT_USAGE, false
+	}
+
+	path, src, err := readInput(args[0])
 	if err != nil {
-		os.Exit(65)
+		fmt.Fprintln(os.Stderr, err)
+		return "", "", EXIT_NOINPUT, false
 	}
 
-	err = i.Interpret(stmts)
+	return path, src, EXIT_OK, true
+}
+
+// compile parses and resolves a program, reporting any errors.
+func compile(path string, src string) ([]parser.Stmt, *resolver.Resolution, bool) {
+	stmts, err := golox.Parse(src)
+	var res *resolver.Resolution
+	if err == nil {
+		res, err = resolver.NewResolver().Resolve(stmts)
+	}
 	if err != nil {
-		os.Exit(70)
+		reporter.Report(fault.Diagnostics(err).InFile(path))
+		return nil, nil, false
 	}
+
+	return stmts, res, true
 }
 
-func runPrompt() {
-	s := bufio.NewScanner(os.Stdin)
-	i := interpreter.NewInterpreter()
-	fmt.Print("> ")
-	for s.Scan() {
-		stmts, err := scanAndParse(s.Text())
-		if err == nil {
-			r := resolver.NewResolver(i)
-			err = r.Resolve(stmts)
-		}
-		if err == nil {
-			i.Interpret(stmts)
+func runCommand(fs *flag.FlagSet, args []string) int {
+	code := fs.String("e", "", "run this code instead of a script")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+
+	// everything after the script is passed on to it
+	files, args := []string{}, fs.Args()
+	if *code == "" && len(args) > 0 {
+		files, args = args[:1], args[1:]
+	}
+
+	path, src, status, ok := input(fs, *code, files)
+	if !ok {
+		return status
+	}
+
+	stmts, res, ok := compile(path, src)
+	if !ok {
+		return EXIT_COMPILE
+	}
+
+	b := newBackend(backendName, path, args, os.Exit)
+	if status, err := b.run(stmts, res, false); err != nil {
+		reporter.Report(fault.Diagnostics(err).InFile(path))
+		return status
+	}
+
+	return EXIT_OK
+}
+
+func checkCommand(fs *flag.FlagSet, args []string) int {
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return EXIT_USAGE
+	}
+
+	status := EXIT_OK
+	for _, arg := range fs.Args() {
+		path, src, err := readInput(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = EXIT_NOINPUT
+		} else if _, _, ok := compile(path, src); !ok && status == EXIT_OK {
+			status = EXIT_COMPILE
 		}
-		fmt.Print("> ")
 	}
 
-	if err := s.Err(); err == nil {
-		fmt.Println("bye")
-		os.Exit(0)
+	return status
+}
+
+func tokensCommand(fs *flag.FlagSet, args []string) int {
+	code := fs.String("e", "", "use this code instead of a file")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
 	}
+
+	path, src, status, ok := input(fs, *code, fs.Args())
+	if !ok {
+		return status
+	}
+
+	if err := printTokens(src); err != nil {
+		reporter.Report(fault.Diagnostics(err).InFile(path))
+		return EXIT_COMPILE
+	}
+
+	return EXIT_OK
 }
 
-func scanAndParse(source string) ([]parser.Stmt, error) {
-	s := scanner.NewScanner(source)
+// printTokens prints a token per line, including those the scanner made of
+// text it could not make sense of, and returns the errors it found.
+func printTokens(src string) error {
+	s := scanner.NewScanner(src)
 	err := s.ScanTokens()
+	for _, t := range s.Tokens {
+		fmt.Printf("%d:%d %s %q\n", t.Line, t.Column, scanner.TypeName(t.TokenType), t.Lexeme)
+	}
+
+	return err
+}
+
+func astCommand(fs *flag.FlagSet, args []string) int {
+	code := fs.String("e", "", "use this code instead of a file")
+	asJSON := fs.Bool("json", false, "print the tree as JSON, with the tokens and spans of every node")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+
+	path, src, status, ok := input(fs, *code, fs.Args())
+	if !ok {
+		return status
+	}
+
+	stmts, err := golox.Parse(src)
 	if err != nil {
-		return nil, err
+		reporter.Report(fault.Diagnostics(err).InFile(path))
+		return EXIT_COMPILE
+	}
+
+	if !*asJSON {
+		fmt.Print(printer.Print(stmts))
+		return EXIT_OK
 	}
 
-	p := parser.NewParser(s.Tokens)
-	stmts, err := p.Parse()
+	data, err := parser.EncodeJSON(stmts)
+	if err == nil {
+		var b bytes.Buffer
+		if err = json.Indent(&b, data, "", "  "); err == nil {
+			b.WriteString("\n")
+			_, err = b.WriteTo(os.Stdout)
+		}
+	}
 	if err != nil {
-		return nil, err
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_IO
+	}
+
+	return EXIT_OK
+}
+
+func fmtCommand(fs *flag.FlagSet, args []string) int {
+	write := fs.Bool("w", false, "write the result to the files instead of printing it")
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return EXIT_USAGE
+	}
+
+	status := EXIT_OK
+	for _, arg := range fs.Args() {
+		path, src, err := readInput(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = EXIT_NOINPUT
+			continue
+		}
+
+		formatted, err := format.Source(src)
+		if err != nil {
+			reporter.Report(fault.Diagnostics(err).InFile(path))
+			if status == EXIT_OK {
+				status = EXIT_COMPILE
+			}
+			continue
+		}
+
+		// the standard input has nowhere to be written back to
+		if !*write || path == STDIN {
+			fmt.Print(formatted)
+			continue
+		}
+
+		if formatted != src {
+			if err := writeFile(path, formatted); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				status = EXIT_IO
+			}
+		}
+	}
+
+	return status
+}
+
+// writeFile replaces the contents of a file, keeping its permissions.
+func writeFile(path string, src string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, []byte(src), info.Mode().Perm())
+}
+
+func replCommand(fs *flag.FlagSet, args []string) int {
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return EXIT_USAGE
+	}
+
+	return runPrompt(func(exit func(status int)) backend {
+		return newBackend(backendName, "", nil, exit)
+	})
+}
+
+func helpCommand(fs *flag.FlagSet, args []string) int {
+	if status, ok := parseFlags(fs, args); !ok {
+		return status
+	}
+
+	if fs.NArg() == 0 {
+		usage(os.Stdout)
+		return EXIT_OK
+	}
+
+	for _, c := range subcommands {
+		if c.name == fs.Arg(0) {
+			// the command defines its flags before asking for help on them
+			help := newFlagSet(c.name)
+			help.SetOutput(os.Stdout)
+			help.Usage = func() { commandUsage(help, c) }
+			return c.run(help, []string{"-h"})
+		}
 	}
 
-	return stmts, nil
+	fmt.Fprintf(os.Stderr, "unknown command %s\n", fs.Arg(0))
+	return EXIT_USAGE
 }
@@ -0,0 +1,710 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+
+	"golox/pkg/fault"
+	"golox/pkg/parser"
+	"golox/pkg/resolver"
+	"golox/pkg/scanner"
+)
+
+const (
+	F_SCRIPT   = 0
+	F_FUNCTION = 1
+	F_METHOD   = 2
+	F_INIT     = 3
+)
+
+const maxLocals = math.MaxUint8 + 1
+
+type local struct {
+	name     string
+	depth    int
+	captured bool
+}
+
+type upvalue struct {
+	index byte
+	local bool
+}
+
+// loop collects the jumps of break and continue statements, which are
+// patched once the loop's exit and increment are known.
+type loop struct {
+	enclosing *loop
+	depth     int
+	breaks    []int
+	continues []int
+}
+
+type function struct {
+	enclosing *function
+	fn        *Function
+	ftype     int
+	locals    []local
+	upvalues  []upvalue
+	depth     int
+	loop      *loop
+}
+
+type class struct {
+	enclosing *class
+	super     bool
+}
+
+// Compiler turns a resolved syntax tree into bytecode for the vm package.
+// The resolution tells locals apart from globals; their stack slots are
+// assigned by the compiler itself.
+type Compiler struct {
+	locals  map[parser.Expr]resolver.Local
+	current *function
+	class   *class
+	line    int
+}
+
+func NewCompiler() *Compiler {
+	return &Compiler{nil, nil, nil, 1}
+}
+
+// Compile compiles a script. Like Interpreter.Eval, the script returns the
+// value of its last statement if that is an expression statement.
+func (c *Compiler) Compile(stmts []parser.Stmt, res *resolver.Resolution) (fn *Function, err error) {
+	c.locals = res.Locals
+	defer func() {
+		if r := recover(); r != nil {
+			d, ok := r.(*fault.Diagnostic)
+			if !ok {
+				panic(r)
+			}
+			c.current = nil
+			c.class = nil
+			fn, err = nil, fault.List{d}
+		}
+	}()
+
+	c.begin("", F_SCRIPT)
+	for k, stmt := range stmts {
+		if e, ok := stmt.(*parser.ExprStmt); ok && k == len(stmts)-1 {
+			e.Expression.Accept(c)
+			c.emit(OP_RETURN)
+			break
+		}
+		stmt.Accept(c)
+	}
+
+	return c.end(), nil
+}
+
+func (c *Compiler) VisitExprStmt(e *parser.ExprStmt) (interface{}, error) {
+	e.Expression.Accept(c)
+	c.emit(OP_POP)
+	return nil, nil
+}
+
+func (c *Compiler) VisitPrintStmt(p *parser.PrintStmt) (interface{}, error) {
+	p.Expression.Accept(c)
+	c.emit(OP_PRINT)
+	return nil, nil
+}
+
+func (c *Compiler) VisitVarStmt(v *parser.VarStmt) (interface{}, error) {
+	c.line = v.Name.Line
+	if c.current.depth > 0 {
+		c.addLocal(v.Name.Lexeme)
+	}
+
+	if v.Initializer != nil {
+		v.Initializer.Accept(c)
+	} else {
+		c.emit(OP_NIL)
+	}
+
+	c.define(v.Name.Lexeme)
+	return nil, nil
+}
+
+func (c *Compiler) VisitBlockStmt(b *parser.BlockStmt) (interface{}, error) {
+	c.beginScope()
+	for _, stmt := range b.Statements {
+		stmt.Accept(c)
+	}
+	c.endScope()
+
+	return nil, nil
+}
+
+func (c *Compiler) VisitIfStmt(i *parser.IfStmt) (interface{}, error) {
+	i.Condition.Accept(c)
+	thenJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emit(OP_POP)
+	i.ThenBranch.Accept(c)
+
+	elseJump := c.emitJump(OP_JUMP)
+	c.patchJump(thenJump)
+	c.emit(OP_POP)
+	if i.ElseBranch != nil {
+		i.ElseBranch.Accept(c)
+	}
+	c.patchJump(elseJump)
+
+	return nil, nil
+}
+
+func (c *Compiler) VisitWhileStmt(w *parser.WhileStmt) (interface{}, error) {
+	l := &loop{c.current.loop, c.current.depth, nil, nil}
+	c.current.loop = l
+
+	start := len(c.chunk().Code)
+	w.Condition.Accept(c)
+	exitJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emit(OP_POP)
+	w.Body.Accept(c)
+
+	for _, jump := range l.continues {
+		c.patchJump(jump)
+	}
+	if w.Increment != nil {
+		w.Increment.Accept(c)
+		c.emit(OP_POP)
+	}
+	c.emitLoop(start)
+
+	c.patchJump(exitJump)
+	c.emit(OP_POP)
+	for _, jump := range l.breaks {
+		c.patchJump(jump)
+	}
+
+	c.current.loop = l.enclosing
+	return nil, nil
+}
+
+func (c *Compiler) VisitBreakStmt(b *parser.BreakStmt) (interface{}, error) {
+	c.line = b.Keyword.Line
+	l := c.current.loop
+	c.discardLocals(l.depth)
+	l.breaks = append(l.breaks, c.emitJump(OP_JUMP))
+	return nil, nil
+}
+
+func (c *Compiler) VisitContinueStmt(s *parser.ContinueStmt) (interface{}, error) {
+	c.line = s.Keyword.Line
+	l := c.current.loop
+	c.discardLocals(l.depth)
+	l.continues = append(l.continues, c.emitJump(OP_JUMP))
+	return nil, nil
+}
+
+func (c *Compiler) VisitImportStmt(i *parser.ImportStmt) (interface{}, error) {
+	panic(c.unsupported(i, "imports"))
+}
+
+// VisitExportStmt compiles the declaration alone so that a module can still
+// be run as a script.
+func (c *Compiler) VisitExportStmt(e *parser.ExportStmt) (interface{}, error) {
+	return e.Declaration.Accept(c)
+}
+
+func (c *Compiler) VisitThrowStmt(t *parser.ThrowStmt) (interface{}, error) {
+	panic(c.unsupported(t, "exceptions"))
+}
+
+func (c *Compiler) VisitTryStmt(t *parser.TryStmt) (interface{}, error) {
+	panic(c.unsupported(t, "exceptions"))
+}
+
+func (c *Compiler) VisitFunStmt(f *parser.FunStmt) (interface{}, error) {
+	c.line = f.Name.Line
+	if c.current.depth > 0 {
+		c.addLocal(f.Name.Lexeme)
+		c.markInitialized()
+	}
+
+	c.function(f.Name.Lexeme, f.Params, f.Body, F_FUNCTION)
+	c.define(f.Name.Lexeme)
+	return nil, nil
+}
+
+func (c *Compiler) VisitReturnStmt(r *parser.ReturnStmt) (interface{}, error) {
+	c.line = r.Keyword.Line
+	if r.Value != nil {
+		r.Value.Accept(c)
+		c.emit(OP_RETURN)
+	} else {
+		c.emitReturn()
+	}
+
+	return nil, nil
+}
+
+func (c *Compiler) VisitClassStmt(s *parser.ClassStmt) (interface{}, error) {
+	c.line = s.Name.Line
+	name := c.constant(s.Name.Lexeme)
+	if c.current.depth > 0 {
+		c.addLocal(s.Name.Lexeme)
+		c.markInitialized()
+	}
+	c.emitShort(OP_CLASS, name)
+	c.define(s.Name.Lexeme)
+
+	c.class = &class{c.class, s.Super != nil}
+	if s.Super != nil {
+		s.Super.Accept(c)
+		c.beginScope()
+		c.addLocal("super")
+		c.markInitialized()
+
+		c.named(s.Name.Lexeme)
+		c.line = s.Super.Name.Line
+		c.emitShort(OP_INHERIT, c.constant(s.Super.Name.Lexeme))
+	}
+
+	c.named(s.Name.Lexeme)
+	for _, method := range s.Methods {
+		c.line = method.Name.Line
+		if method.Name.Lexeme == "init" {
+			c.function(method.Name.Lexeme, method.Params, method.Body, F_INIT)
+		} else {
+			c.function(method.Name.Lexeme, method.Params, method.Body, F_METHOD)
+		}
+		c.emitShort(OP_METHOD, c.constant(method.Name.Lexeme))
+	}
+	c.emit(OP_POP)
+
+	if s.Super != nil {
+		c.endScope()
+	}
+
+	c.class = c.class.enclosing
+	return nil, nil
+}
+
+func (c *Compiler) VisitBinaryExpr(b *parser.BinaryExpr) (interface{}, error) {
+	b.Left.Accept(c)
+	b.Right.Accept(c)
+
+	c.line = b.Operator.Line
+	switch b.Operator.TokenType {
+	case scanner.BANG_EQUAL:
+		c.emit(OP_EQUAL)
+		c.emit(OP_NOT)
+	case scanner.EQUAL_EQUAL:
+		c.emit(OP_EQUAL)
+	case scanner.GREATER:
+		c.emit(OP_GREATER)
+	case scanner.GREATER_EQUAL:
+		c.emit(OP_GREATER_EQUAL)
+	case scanner.LESS:
+		c.emit(OP_LESS)
+	case scanner.LESS_EQUAL:
+		c.emit(OP_LESS_EQUAL)
+	case scanner.MINUS:
+		c.emit(OP_SUBTRACT)
+	case scanner.PLUS:
+		c.emit(OP_ADD)
+	case scanner.SLASH:
+		c.emit(OP_DIVIDE)
+	case scanner.STAR:
+		c.emit(OP_MULTIPLY)
+	}
+
+	return nil, nil
+}
+
+func (c *Compiler) VisitGroupingExpr(g *parser.GroupingExpr) (interface{}, error) {
+	g.Expression.Accept(c)
+	return nil, nil
+}
+
+func (c *Compiler) VisitLiteralExpr(l *parser.LiteralExpr) (interface{}, error) {
+	switch l.Value {
+	case nil:
+		c.emit(OP_NIL)
+	case true:
+		c.emit(OP_TRUE)
+	case false:
+		c.emit(OP_FALSE)
+	default:
+		c.emitShort(OP_CONSTANT, c.constant(l.Value))
+	}
+
+	return nil, nil
+}
+
+func (c *Compiler) VisitUnaryExpr(u *parser.UnaryExpr) (interface{}, error) {
+	u.Right.Accept(c)
+
+	c.line = u.Operator.Line
+	switch u.Operator.TokenType {
+	case scanner.MINUS:
+		c.emit(OP_NEGATE)
+	case scanner.BANG:
+		c.emit(OP_NOT)
+	}
+
+	return nil, nil
+}
+
+func (c *Compiler) VisitVariableExpr(v *parser.VariableExpr) (interface{}, error) {
+	c.line = v.Name.Line
+	c.get(v, v.Name.Lexeme)
+	return nil, nil
+}
+
+func (c *Compiler) VisitAssignExpr(a *parser.AssignExpr) (interface{}, error) {
+	a.Value.Accept(c)
+
+	c.line = a.Name.Line
+	if _, ok := c.locals[a]; ok {
+		if slot := c.current.resolveLocal(a.Name.Lexeme); slot != -1 {
+			c.emitByte(OP_SET_LOCAL, byte(slot))
+		} else if index := c.resolveUpvalue(c.current, a.Name.Lexeme); index != -1 {
+			c.emitByte(OP_SET_UPVALUE, byte(index))
+		}
+	} else {
+		c.emitShort(OP_SET_GLOBAL, c.constant(a.Name.Lexeme))
+	}
+
+	return nil, nil
+}
+
+func (c *Compiler) VisitLogicalExpr(l *parser.LogicalExpr) (interface{}, error) {
+	l.Left.Accept(c)
+
+	if l.Operator.TokenType == scanner.OR {
+		elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+		endJump := c.emitJump(OP_JUMP)
+		c.patchJump(elseJump)
+		c.emit(OP_POP)
+		l.Right.Accept(c)
+		c.patchJump(endJump)
+	} else {
+		endJump := c.emitJump(OP_JUMP_IF_FALSE)
+		c.emit(OP_POP)
+		l.Right.Accept(c)
+		c.patchJump(endJump)
+	}
+
+	return nil, nil
+}
+
+func (c *Compiler) VisitCallExpr(e *parser.CallExpr) (interface{}, error) {
+	switch callee := e.Callee.(type) {
+	case *parser.GetExpr:
+		callee.Object.Accept(c)
+		c.arguments(e.Arguments)
+		c.line = e.Paren.Line
+		c.emitShort(OP_INVOKE, c.constant(callee.Name.Lexeme))
+		c.chunk().write(byte(len(e.Arguments)), c.line)
+	case *parser.SuperExpr:
+		c.get(callee, "this")
+		c.arguments(e.Arguments)
+		c.get(callee, "super")
+		c.line = e.Paren.Line
+		c.emitShort(OP_SUPER_INVOKE, c.constant(callee.Method.Lexeme))
+		c.chunk().write(byte(len(e.Arguments)), c.line)
+	default:
+		e.Callee.Accept(c)
+		c.arguments(e.Arguments)
+		c.line = e.Paren.Line
+		c.emitByte(OP_CALL, byte(len(e.Arguments)))
+	}
+
+	return nil, nil
+}
+
+func (c *Compiler) VisitGetExpr(g *parser.GetExpr) (interface{}, error) {
+	g.Object.Accept(c)
+	c.line = g.Name.Line
+	c.emitShort(OP_GET_PROPERTY, c.constant(g.Name.Lexeme))
+	return nil, nil
+}
+
+func (c *Compiler) VisitSetExpr(s *parser.SetExpr) (interface{}, error) {
+	s.Object.Accept(c)
+	s.Value.Accept(c)
+	c.line = s.Name.Line
+	c.emitShort(OP_SET_PROPERTY, c.constant(s.Name.Lexeme))
+	return nil, nil
+}
+
+func (c *Compiler) VisitThisExpr(t *parser.ThisExpr) (interface{}, error) {
+	c.line = t.Keyword.Line
+	c.get(t, "this")
+	return nil, nil
+}
+
+func (c *Compiler) VisitSuperExpr(s *parser.SuperExpr) (interface{}, error) {
+	c.line = s.Keyword.Line
+	c.get(s, "this")
+	c.get(s, "super")
+	c.emitShort(OP_GET_SUPER, c.constant(s.Method.Lexeme))
+	return nil, nil
+}
+
+func (c *Compiler) VisitFunctionExpr(f *parser.FunctionExpr) (interface{}, error) {
+	c.line = f.Keyword.Line
+	c.function("", f.Params, f.Body, F_FUNCTION)
+	return nil, nil
+}
+
+func (c *Compiler) VisitListExpr(l *parser.ListExpr) (interface{}, error) {
+	panic(c.unsupported(l, "lists"))
+}
+
+func (c *Compiler) VisitIndexExpr(i *parser.IndexExpr) (interface{}, error) {
+	panic(c.unsupported(i, "subscripts"))
+}
+
+func (c *Compiler) VisitIndexSetExpr(i *parser.IndexSetExpr) (interface{}, error) {
+	panic(c.unsupported(i, "subscripts"))
+}
+
+func (c *Compiler) VisitMapExpr(m *parser.MapExpr) (interface{}, error) {
+	panic(c.unsupported(m, "maps"))
+}
+
+// unsupported reports a language feature that only the tree-walking
+// interpreter implements.
+func (c *Compiler) unsupported(node interface{ Span() scanner.Span }, feature string) *fault.Diagnostic {
+	span := node.Span()
+	message := fmt.Sprintf("%s are not supported by the bytecode backend", feature)
+	return fault.NewDiagnosticAt(fault.UNSUPPORTED_FEATURE, span.Line, span.Column, span.Start, span.End, message)
+}
+
+func (c *Compiler) begin(name string, ftype int) {
+	f := &function{c.current, &Function{name, 0, 0, &Chunk{}}, ftype, make([]local, 0, 8), nil, 0, nil}
+	if ftype == F_METHOD || ftype == F_INIT {
+		f.locals = append(f.locals, local{"this", 0, false})
+	} else {
+		f.locals = append(f.locals, local{"", 0, false})
+	}
+
+	c.current = f
+}
+
+func (c *Compiler) end() *Function {
+	c.emitReturn()
+	fn := c.current.fn
+	c.current = c.current.enclosing
+	return fn
+}
+
+func (c *Compiler) function(name string, params []*scanner.Token, body *parser.BlockStmt, ftype int) {
+	line := c.line
+	c.begin(name, ftype)
+	c.beginScope()
+	c.current.fn.Arity = len(params)
+	for _, param := range params {
+		c.addLocal(param.Lexeme)
+		c.markInitialized()
+	}
+
+	for _, stmt := range body.Statements {
+		stmt.Accept(c)
+	}
+
+	compiled := c.current
+	fn := c.end()
+	fn.Upvalues = len(compiled.upvalues)
+
+	c.line = line
+	c.emitShort(OP_CLOSURE, c.constant(fn))
+	for _, up := range compiled.upvalues {
+		if up.local {
+			c.chunk().write(1, c.line)
+		} else {
+			c.chunk().write(0, c.line)
+		}
+		c.chunk().write(up.index, c.line)
+	}
+}
+
+func (c *Compiler) arguments(args []parser.Expr) {
+	for _, arg := range args {
+		arg.Accept(c)
+	}
+}
+
+// get loads the variable called name, using the resolver's verdict on expr to
+// decide whether it lives on the stack, in an upvalue or in the globals.
+func (c *Compiler) get(expr parser.Expr, name string) {
+	if _, ok := c.locals[expr]; ok {
+		if slot := c.current.resolveLocal(name); slot != -1 {
+			c.emitByte(OP_GET_LOCAL, byte(slot))
+			return
+		}
+
+		if index := c.resolveUpvalue(c.current, name); index != -1 {
+			c.emitByte(OP_GET_UPVALUE, byte(index))
+			return
+		}
+	}
+
+	c.emitShort(OP_GET_GLOBAL, c.constant(name))
+}
+
+// named loads a variable the compiler itself declared, such as the name of a
+// class while its methods are being attached.
+func (c *Compiler) named(name string) {
+	if c.current.depth > 0 {
+		if slot := c.current.resolveLocal(name); slot != -1 {
+			c.emitByte(OP_GET_LOCAL, byte(slot))
+			return
+		}
+	}
+
+	c.emitShort(OP_GET_GLOBAL, c.constant(name))
+}
+
+func (c *Compiler) define(name string) {
+	if c.current.depth > 0 {
+		c.markInitialized()
+		return
+	}
+
+	c.emitShort(OP_DEFINE_GLOBAL, c.constant(name))
+}
+
+func (c *Compiler) addLocal(name string) {
+	if len(c.current.locals) == maxLocals {
+		panic(fault.NewDiagnostic(fault.TOO_MANY_ITEMS, c.line, "too many local variables in function"))
+	}
+
+	c.current.locals = append(c.current.locals, local{name, -1, false})
+}
+
+func (c *Compiler) markInitialized() {
+	c.current.locals[len(c.current.locals)-1].depth = c.current.depth
+}
+
+func (c *Compiler) beginScope() {
+	c.current.depth++
+}
+
+func (c *Compiler) endScope() {
+	f := c.current
+	f.depth--
+	c.discardLocals(f.depth)
+	for len(f.locals) > 0 && f.locals[len(f.locals)-1].depth > f.depth {
+		f.locals = f.locals[:len(f.locals)-1]
+	}
+}
+
+// discardLocals pops the locals declared deeper than depth off the stack at
+// runtime, without forgetting them at compile time.
+func (c *Compiler) discardLocals(depth int) {
+	locals := c.current.locals
+	for i := len(locals) - 1; i >= 0 && locals[i].depth > depth; i-- {
+		if locals[i].captured {
+			c.emit(OP_CLOSE_UPVALUE)
+		} else {
+			c.emit(OP_POP)
+		}
+	}
+}
+
+func (f *function) resolveLocal(name string) int {
+	for i := len(f.locals) - 1; i >= 0; i-- {
+		if f.locals[i].name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (c *Compiler) resolveUpvalue(f *function, name string) int {
+	if f.enclosing == nil {
+		return -1
+	}
+
+	if slot := f.enclosing.resolveLocal(name); slot != -1 {
+		f.enclosing.locals[slot].captured = true
+		return c.addUpvalue(f, byte(slot), true)
+	}
+
+	if index := c.resolveUpvalue(f.enclosing, name); index != -1 {
+		return c.addUpvalue(f, byte(index), false)
+	}
+
+	return -1
+}
+
+func (c *Compiler) addUpvalue(f *function, index byte, isLocal bool) int {
+	for i, up := range f.upvalues {
+		if up.index == index && up.local == isLocal {
+			return i
+		}
+	}
+
+	if len(f.upvalues) == maxLocals {
+		panic(fault.NewDiagnostic(fault.TOO_MANY_ITEMS, c.line, "too many closure variables in function"))
+	}
+
+	f.upvalues = append(f.upvalues, upvalue{index, isLocal})
+	return len(f.upvalues) - 1
+}
+
+func (c *Compiler) chunk() *Chunk {
+	return c.current.fn.Chunk
+}
+
+func (c *Compiler) constant(value interface{}) int {
+	index := c.chunk().addConstant(value)
+	if index > math.MaxUint16 {
+		panic(fault.NewDiagnostic(fault.TOO_MANY_ITEMS, c.line, "too many constants in one chunk"))
+	}
+
+	return index
+}
+
+func (c *Compiler) emit(op OpCode) {
+	c.chunk().write(byte(op), c.line)
+}
+
+func (c *Compiler) emitByte(op OpCode, operand byte) {
+	c.chunk().write(byte(op), c.line)
+	c.chunk().write(operand, c.line)
+}
+
+func (c *Compiler) emitShort(op OpCode, operand int) {
+	c.chunk().write(byte(op), c.line)
+	c.chunk().write(byte(operand>>8), c.line)
+	c.chunk().write(byte(operand), c.line)
+}
+
+func (c *Compiler) emitReturn() {
+	if c.current.ftype == F_INIT {
+		c.emitByte(OP_GET_LOCAL, 0)
+	} else {
+		c.emit(OP_NIL)
+	}
+	c.emit(OP_RETURN)
+}
+
+func (c *Compiler) emitJump(op OpCode) int {
+	c.emitShort(op, 0xffff)
+	return len(c.chunk().Code) - 2
+}
+
+func (c *Compiler) patchJump(offset int) {
+	jump := len(c.chunk().Code) - offset - 2
+	if jump > math.MaxUint16 {
+		panic(fault.NewDiagnostic(fault.TOO_MANY_ITEMS, c.line, "too much code to jump over"))
+	}
+
+	c.chunk().Code[offset] = byte(jump >> 8)
+	c.chunk().Code[offset+1] = byte(jump)
+}
+
+func (c *Compiler) emitLoop(start int) {
+	offset := len(c.chunk().Code) - start + 3
+	if offset > math.MaxUint16 {
+		panic(fault.NewDiagnostic(fault.TOO_MANY_ITEMS, c.line, fmt.Sprintf("loop body too large (%d bytes)", offset)))
+	}
+
+	c.emitShort(OP_LOOP, offset)
+}
@@ -0,0 +1,173 @@
+package fault
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Severity int
+
+const (
+	ERROR Severity = iota
+	WARNING
+	NOTE
+)
+
+func (s Severity) String() string {
+	switch s {
+	case WARNING:
+		return "warning"
+	case NOTE:
+		return "note"
+	}
+
+	return "error"
+}
+
+// Error codes group diagnostics by the phase that produced them: 1xx for the
+// scanner, 2xx for the parser, 3xx for the resolver, 4xx at runtime and 5xx
+// for the bytecode compiler. Warnings are numbered the same way with a W
+// prefix.
+const (
+	UNKNOWN_CHARACTER   = "E100"
+	UNTERMINATED_STRING = "E101"
+
+	UNEXPECTED_TOKEN   = "E200"
+	INVALID_ASSIGNMENT = "E201"
+	TOO_MANY_ITEMS     = "E202"
+
+	INVALID_RETURN      = "E300"
+	REDECLARED_VARIABLE = "E301"
+	SELF_REFERENCE      = "E302"
+	INVALID_CLASS_USE   = "E303"
+	SELF_INHERITANCE    = "E304"
+	INVALID_JUMP        = "E305"
+	INVALID_EXPORT      = "E306"
+
+	UNDEFINED_GLOBAL = "W300"
+
+	RUNTIME_ERROR  = "E400"
+	THROWN_VALUE   = "E401"
+	LIMIT_EXCEEDED = "E402"
+
+	UNSUPPORTED_FEATURE = "E500"
+)
+
+// Span is a half open range of byte offsets into the source.
+type Span struct {
+	Start int
+	End   int
+}
+
+// Label points at a secondary location related to a diagnostic, such as the
+// first declaration of a variable that is redeclared.
+type Label struct {
+	Line    int
+	Column  int
+	Span    Span
+	Message string
+}
+
+// Frame is one call on the Lox stack at the time of a runtime error.
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+	Column   int
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s (%s)", f.Function, position(f.File, f.Line, f.Column))
+}
+
+// Diagnostic describes a problem found in a Lox program. Line and Column
+// are 1-based, and a Column of 0 means the column is unknown. Trace holds
+// the call stack of runtime errors, innermost call first.
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	File     string
+	Line     int
+	Column   int
+	Span     Span
+	Message  string
+	Labels   []Label
+	Trace    []Frame
+}
+
+func NewDiagnostic(code string, line int, message string) *Diagnostic {
+	return &Diagnostic{ERROR, code, "", line, 0, Span{}, message, nil, nil}
+}
+
+// NewDiagnosticAt creates an error diagnostic for the source text between
+// the byte offsets start and end.
+func NewDiagnosticAt(code string, line int, column int, start int, end int, message string) *Diagnostic {
+	return &Diagnostic{ERROR, code, "", line, column, Span{start, end}, message, nil, nil}
+}
+
+func (d *Diagnostic) AddLabel(line int, column int, start int, end int, message string) {
+	d.Labels = append(d.Labels, Label{line, column, Span{start, end}, message})
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("Error (line %d): %s.", d.Line, d.Message)
+}
+
+// List collects the diagnostics of one compilation phase. It is returned as
+// an error by the scanner, parser and resolver.
+type List []*Diagnostic
+
+func (l List) Error() string {
+	messages := make([]string, len(l))
+	for i, d := range l {
+		messages[i] = d.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// Err returns the list as an error, or nil when it holds no errors.
+func (l List) Err() error {
+	for _, d := range l {
+		if d.Severity == ERROR {
+			return l
+		}
+	}
+
+	return nil
+}
+
+// InFile records the name of the file the diagnostics were found in, for
+// those that do not know it yet. Stack frames without a file are assumed to
+// be in the same one.
+func (l List) InFile(name string) List {
+	for _, d := range l {
+		if d.File == "" {
+			d.File = name
+		}
+		for i := range d.Trace {
+			if d.Trace[i].File == "" {
+				d.Trace[i].File = name
+			}
+		}
+	}
+
+	return l
+}
+
+// Diagnostics converts any error produced while running Lox code into a
+// list of diagnostics.
+func Diagnostics(err error) List {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case List:
+		return e
+	case *Diagnostic:
+		return List{e}
+	case *Fault:
+		return List{&e.Diagnostic}
+	}
+
+	return List{NewDiagnostic(RUNTIME_ERROR, 0, err.Error())}
+}
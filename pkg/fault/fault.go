@@ -1,18 +1,19 @@
 package fault
 
-import "fmt"
-
+// Fault is a runtime error raised while a Lox program executes. Faults raised
+// by a throw statement have the code THROWN_VALUE and carry the thrown Lox
+// value.
 type Fault struct {
-	line    int
-	message string
+	Diagnostic
+	Value interface{}
 }
 
-func (f *Fault) Error() string {
-	return fmt.Sprintf("Error (line %d): %s.", f.line, f.message)
+func NewFault(line int, message string) *Fault {
+	return &Fault{*NewDiagnostic(RUNTIME_ERROR, line, message), nil}
 }
 
-func NewFault(line int, message string) *Fault {
-	fault := &Fault{line, message}
-	fmt.Println(fault)
-	return fault
+// NewFaultAt creates a runtime error for the source text between the byte
+// offsets start and end.
+func NewFaultAt(line int, column int, start int, end int, message string) *Fault {
+	return &Fault{*NewDiagnosticAt(RUNTIME_ERROR, line, column, start, end, message), nil}
 }
@@ -0,0 +1,229 @@
+package fault
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Reporter renders diagnostics for a human or a tool.
+type Reporter interface {
+	Report(diags List)
+}
+
+type textReporter struct {
+	w io.Writer
+}
+
+// NewTextReporter writes one line per diagnostic in the form
+// file:line:column: severity[code]: message, followed by the stack trace of
+// runtime errors.
+func NewTextReporter(w io.Writer) Reporter {
+	return &textReporter{w}
+}
+
+func (r *textReporter) Report(diags List) {
+	for _, d := range diags {
+		fmt.Fprintf(r.w, "%s: %s[%s]: %s\n", location(d), d.Severity, d.Code, d.Message)
+		trace(r.w, d)
+	}
+}
+
+func location(d *Diagnostic) string {
+	return position(d.File, d.Line, d.Column)
+}
+
+func position(file string, line int, column int) string {
+	position := fmt.Sprintf("line %d", line)
+	if file != "" {
+		position = fmt.Sprintf("%s:%d", file, line)
+	}
+
+	if column > 0 {
+		position = fmt.Sprintf("%s:%d", position, column)
+	}
+
+	return position
+}
+
+// trace writes the stack trace of a runtime error below its message.
+func trace(w io.Writer, d *Diagnostic) {
+	if len(d.Trace) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "stack trace:")
+	for k := 0; k < len(d.Trace); k++ {
+		fmt.Fprintf(w, "    at %s\n", d.Trace[k])
+
+		// collapse the frames of a runaway recursion
+		n := 0
+		for k+1 < len(d.Trace) && d.Trace[k+1] == d.Trace[k] {
+			k++
+			n++
+		}
+		if n > 0 {
+			fmt.Fprintf(w, "    ... repeated %d more times\n", n)
+		}
+	}
+}
+
+// Sources maps file names to their contents so that reporters can quote
+// them. Diagnostics without a file name are looked up under "".
+type Sources map[string]string
+
+type snippetReporter struct {
+	w       io.Writer
+	sources Sources
+}
+
+// NewSnippetReporter renders each diagnostic with the source lines it refers
+// to, underlining the primary location with carets and related locations
+// with dashes:
+//
+//	error[E301]: variable cannot be redeclared in local scope
+//	 --> test.lox:3:9
+//	  |
+//	2 |     var a = 1;
+//	  |         - first declared here
+//	3 |     var a = 2;
+//	  |         ^
+//
+// The sources map is consulted at report time, so callers may keep adding
+// to it. Diagnostics whose source is unknown are rendered on a single line.
+func NewSnippetReporter(w io.Writer, sources Sources) Reporter {
+	return &snippetReporter{w, sources}
+}
+
+type mark struct {
+	line   int
+	column int
+	width  int
+	marker string
+	text   string
+}
+
+func (r *snippetReporter) Report(diags List) {
+	for _, d := range diags {
+		fmt.Fprintf(r.w, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+		fmt.Fprintf(r.w, " --> %s\n", location(d))
+
+		r.snippet(d)
+		trace(r.w, d)
+	}
+}
+
+func (r *snippetReporter) snippet(d *Diagnostic) {
+	source, ok := r.sources[d.File]
+	if !ok || d.Line == 0 {
+		return
+	}
+	lines := strings.Split(source, "\n")
+
+	marks := []mark{{d.Line, d.Column, d.Span.End - d.Span.Start, "^", ""}}
+	for _, l := range d.Labels {
+		marks = append(marks, mark{l.Line, l.Column, l.Span.End - l.Span.Start, "-", l.Message})
+	}
+	sort.SliceStable(marks, func(i, j int) bool { return marks[i].line < marks[j].line })
+
+	gutter := len(fmt.Sprint(marks[len(marks)-1].line))
+	pad := strings.Repeat(" ", gutter)
+	fmt.Fprintf(r.w, "%s |\n", pad)
+
+	previous := 0
+	for _, m := range marks {
+		if m.line < 1 || m.line > len(lines) {
+			continue
+		}
+
+		text := strings.TrimRight(lines[m.line-1], "\r")
+		if m.line != previous {
+			if previous != 0 && m.line > previous+1 {
+				fmt.Fprintf(r.w, "%s...\n", pad)
+			}
+			fmt.Fprintf(r.w, "%*d | %s\n", gutter, m.line, text)
+			previous = m.line
+		}
+
+		if m.column == 0 {
+			continue
+		}
+
+		// keep tabs so the underline lines up with the quoted source
+		start := min(m.column-1, len(text))
+		indent := strings.Map(func(r rune) rune {
+			if r == '\t' {
+				return r
+			}
+			return ' '
+		}, text[:start])
+		end := min(start+m.width, len(text))
+		width := max(utf8.RuneCountInString(text[start:end]), 1)
+
+		underline := indent + strings.Repeat(m.marker, width)
+		if m.text != "" {
+			underline += " " + m.text
+		}
+		fmt.Fprintf(r.w, "%s | %s\n", pad, underline)
+	}
+}
+
+type jsonReporter struct {
+	enc *json.Encoder
+}
+
+// NewJSONReporter writes one JSON object per diagnostic and line.
+func NewJSONReporter(w io.Writer) Reporter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &jsonReporter{enc}
+}
+
+type jsonLabel struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Message string `json:"message"`
+}
+
+type jsonDiagnostic struct {
+	Severity string      `json:"severity"`
+	Code     string      `json:"code"`
+	File     string      `json:"file,omitempty"`
+	Line     int         `json:"line"`
+	Column   int         `json:"column,omitempty"`
+	Start    int         `json:"start"`
+	End      int         `json:"end"`
+	Message  string      `json:"message"`
+	Labels   []jsonLabel `json:"labels,omitempty"`
+	Trace    []jsonFrame `json:"trace,omitempty"`
+}
+
+type jsonFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+}
+
+func (r *jsonReporter) Report(diags List) {
+	for _, d := range diags {
+		labels := make([]jsonLabel, len(d.Labels))
+		for i, l := range d.Labels {
+			labels[i] = jsonLabel{l.Line, l.Column, l.Span.Start, l.Span.End, l.Message}
+		}
+
+		frames := make([]jsonFrame, len(d.Trace))
+		for i, f := range d.Trace {
+			frames[i] = jsonFrame{f.Function, f.File, f.Line, f.Column}
+		}
+
+		r.enc.Encode(jsonDiagnostic{
+			d.Severity.String(), d.Code, d.File, d.Line, d.Column, d.Span.Start, d.Span.End, d.Message, labels, frames,
+		})
+	}
+}
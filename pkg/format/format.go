@@ -0,0 +1,554 @@
+// Package format prints Lox programs in a canonical layout: four spaces of
+// indentation, opening braces on the line of the statement they belong to,
+// one space around binary operators and after commas, and at most one blank
+// line between statements, kept where the source had one.
+//
+// Comments on lines of their own stay before the statement they precede,
+// and comments at the end of a line stay after the statement on it.
+// Comments in the middle of a statement that the formatter puts on one line
+// are moved after it. Formatting formatted source leaves it unchanged.
+package format
+
+import (
+	"sort"
+	"strings"
+
+	"golox/pkg/parser"
+	"golox/pkg/scanner"
+)
+
+// formatter writes the program to b. comments are those of the whole
+// source, of which the ones before index next have been written. last is the
+// source offset where the last statement or comment written ended, and lines
+// holds the offset at which every line starts.
+type formatter struct {
+	src      string
+	comments []scanner.Token
+	next     int
+	last     int
+	lines    []int
+	b        strings.Builder
+	depth    int
+}
+
+// Source formats a program. Programs with syntax errors are returned as
+// they are, together with the errors.
+func Source(src string) (string, error) {
+	stmts, err := parser.ParseSource(src)
+	if err != nil {
+		return src, err
+	}
+
+	// the parser has no use for comments, so the scanner keeps them apart
+	s := scanner.NewScanner(src)
+	s.ScanTokens()
+
+	lines := []int{0}
+	for k := 0; k < len(src); k++ {
+		if src[k] == '\n' {
+			lines = append(lines, k+1)
+		}
+	}
+
+	f := &formatter{src, s.Comments, 0, 0, lines, strings.Builder{}, 0}
+	f.stmts(stmts, len(src))
+	return f.b.String(), nil
+}
+
+func (f *formatter) write(s string) {
+	f.b.WriteString(s)
+}
+
+func (f *formatter) indent() {
+	f.write(strings.Repeat("    ", f.depth))
+}
+
+func (f *formatter) expr(expr parser.Expr) {
+	expr.Accept(f)
+}
+
+func (f *formatter) stmt(stmt parser.Stmt) {
+	stmt.Accept(f)
+}
+
+// line returns the line number of a source offset.
+func (f *formatter) line(offset int) int {
+	return sort.Search(len(f.lines), func(k int) bool { return f.lines[k] > offset })
+}
+
+// stmts writes each statement on lines of its own at the current depth,
+// together with the comments before limit, which is where the list ends.
+func (f *formatter) stmts(stmts []parser.Stmt, limit int) {
+	first := true
+	for k, stmt := range stmts {
+		span := stmt.Span()
+		f.leading(span.Start, &first)
+		f.separate(span.Start, first)
+		first = false
+
+		f.indent()
+		f.stmt(stmt)
+		f.last = span.End
+
+		end := limit
+		if k+1 < len(stmts) {
+			end = stmts[k+1].Span().Start
+		}
+		f.trailing(span.End, end)
+		f.write("\n")
+	}
+
+	f.leading(limit, &first)
+}
+
+// separate writes a blank line before the item at offset start if the
+// source had at least one since the last item, unless start begins a list.
+func (f *formatter) separate(start int, first bool) {
+	if !first && f.last <= start && strings.Count(f.src[f.last:start], "\n") > 1 {
+		f.write("\n")
+	}
+}
+
+// leading writes the comments before offset on lines of their own.
+func (f *formatter) leading(offset int, first *bool) {
+	for f.next < len(f.comments) && f.comments[f.next].Start < offset {
+		c := f.comments[f.next]
+		f.separate(c.Start, *first)
+		*first = false
+
+		f.indent()
+		f.write(c.Lexeme + "\n")
+		f.last = c.End
+		f.next++
+	}
+}
+
+// trailing writes the comments that are left inside an item ending at end,
+// and those on its last line up to limit, after the item. Only the first can
+// stay on the same line.
+func (f *formatter) trailing(end int, limit int) {
+	line := f.line(end - 1)
+	for k := 0; f.next < len(f.comments); k++ {
+		c := f.comments[f.next]
+		if c.Start >= end && (c.Start >= limit || c.Line != line) {
+			break
+		}
+
+		if k == 0 {
+			f.write(" ")
+		} else {
+			f.write("\n")
+			f.indent()
+		}
+		f.write(c.Lexeme)
+		if c.End > f.last {
+			f.last = c.End
+		}
+		f.next++
+	}
+}
+
+// block writes braces around stmts, which go one level deeper. open is
+// where the opening brace ends, or the class header where the parser does
+// not keep the brace; comments on its line stay on the line of the brace.
+// commented reports whether a comment follows end on the same line before
+// limit.
+func (f *formatter) commented(end int, limit int) bool {
+	if f.next == len(f.comments) {
+		return false
+	}
+
+	c := f.comments[f.next]
+	return c.Start < limit && c.Line == f.line(end-1)
+}
+
+func (f *formatter) block(open int, close *scanner.Token, stmts []parser.Stmt) {
+	f.write("{")
+
+	limit := close.Start
+	if len(stmts) > 0 {
+		limit = stmts[0].Span().Start
+	}
+
+	// comments after the first one on the brace's line start lines of
+	// their own inside the block
+	next := f.next
+	f.last = open
+	f.depth++
+	f.trailing(open, limit)
+	f.depth--
+
+	if len(stmts) == 0 && f.next == next && (f.next == len(f.comments) || f.comments[f.next].Start > close.Start) {
+		f.write("}")
+		return
+	}
+
+	f.write("\n")
+	f.depth++
+	f.stmts(stmts, close.Start)
+	f.depth--
+	f.indent()
+	f.write("}")
+}
+
+// body writes the statement controlled by an if or a loop, which is a block
+// or follows on the same line.
+func (f *formatter) body(stmt parser.Stmt) {
+	f.write(" ")
+	if b, ok := stmt.(*parser.BlockStmt); ok && b.Open != nil {
+		f.block(b.Open.End, b.Close, b.Statements)
+		return
+	}
+
+	f.stmt(stmt)
+}
+
+func (f *formatter) params(params []*scanner.Token) {
+	f.write("(")
+	for k, param := range params {
+		if k > 0 {
+			f.write(", ")
+		}
+		f.write(param.Lexeme)
+	}
+	f.write(")")
+}
+
+func (f *formatter) list(exprs []parser.Expr) {
+	for k, expr := range exprs {
+		if k > 0 {
+			f.write(", ")
+		}
+		f.expr(expr)
+	}
+}
+
+// forLoop reports whether w comes from a for loop rather than a while loop.
+func forLoop(w *parser.WhileStmt) bool {
+	return w.Keyword.Lexeme == "for"
+}
+
+// forInit returns the for loop that b was synthesized for, if it is such a
+// block.
+func forInit(b *parser.BlockStmt) (*parser.WhileStmt, bool) {
+	if b.Open != nil || len(b.Statements) != 2 {
+		return nil, false
+	}
+
+	w, ok := b.Statements[1].(*parser.WhileStmt)
+	return w, ok && forLoop(w)
+}
+
+// forStmt writes a for loop with the given initializer, which may be nil.
+func (f *formatter) forStmt(init parser.Stmt, w *parser.WhileStmt) {
+	f.write("for (")
+	if init != nil {
+		f.stmt(init)
+	} else {
+		f.write(";")
+	}
+
+	// the parser fills in true for a missing condition
+	if l, ok := w.Condition.(*parser.LiteralExpr); !ok || l.Token != nil {
+		f.write(" ")
+		f.expr(w.Condition)
+	}
+	f.write(";")
+
+	if w.Increment != nil {
+		f.write(" ")
+		f.expr(w.Increment)
+	}
+	f.write(")")
+	f.body(w.Body)
+}
+
+func (f *formatter) VisitBinaryExpr(b *parser.BinaryExpr) (interface{}, error) {
+	f.expr(b.Left)
+	f.write(" " + b.Operator.Lexeme + " ")
+	f.expr(b.Right)
+	return nil, nil
+}
+
+func (f *formatter) VisitGroupingExpr(g *parser.GroupingExpr) (interface{}, error) {
+	f.write("(")
+	f.expr(g.Expression)
+	f.write(")")
+	return nil, nil
+}
+
+func (f *formatter) VisitLiteralExpr(l *parser.LiteralExpr) (interface{}, error) {
+	if l.Token == nil {
+		f.write("true")
+		return nil, nil
+	}
+
+	f.write(l.Token.Lexeme)
+	return nil, nil
+}
+
+func (f *formatter) VisitUnaryExpr(u *parser.UnaryExpr) (interface{}, error) {
+	f.write(u.Operator.Lexeme)
+	f.expr(u.Right)
+	return nil, nil
+}
+
+func (f *formatter) VisitVariableExpr(v *parser.VariableExpr) (interface{}, error) {
+	f.write(v.Name.Lexeme)
+	return nil, nil
+}
+
+func (f *formatter) VisitAssignExpr(a *parser.AssignExpr) (interface{}, error) {
+	f.write(a.Name.Lexeme + " = ")
+	f.expr(a.Value)
+	return nil, nil
+}
+
+func (f *formatter) VisitLogicalExpr(l *parser.LogicalExpr) (interface{}, error) {
+	f.expr(l.Left)
+	f.write(" " + l.Operator.Lexeme + " ")
+	f.expr(l.Right)
+	return nil, nil
+}
+
+func (f *formatter) VisitCallExpr(c *parser.CallExpr) (interface{}, error) {
+	f.expr(c.Callee)
+	f.write("(")
+	f.list(c.Arguments)
+	f.write(")")
+	return nil, nil
+}
+
+func (f *formatter) VisitGetExpr(g *parser.GetExpr) (interface{}, error) {
+	f.expr(g.Object)
+	f.write("." + g.Name.Lexeme)
+	return nil, nil
+}
+
+func (f *formatter) VisitSetExpr(s *parser.SetExpr) (interface{}, error) {
+	f.expr(s.Object)
+	f.write("." + s.Name.Lexeme + " = ")
+	f.expr(s.Value)
+	return nil, nil
+}
+
+func (f *formatter) VisitThisExpr(t *parser.ThisExpr) (interface{}, error) {
+	f.write("this")
+	return nil, nil
+}
+
+func (f *formatter) VisitSuperExpr(s *parser.SuperExpr) (interface{}, error) {
+	f.write("super." + s.Method.Lexeme)
+	return nil, nil
+}
+
+func (f *formatter) VisitListExpr(l *parser.ListExpr) (interface{}, error) {
+	f.write("[")
+	f.list(l.Elements)
+	f.write("]")
+	return nil, nil
+}
+
+func (f *formatter) VisitIndexExpr(i *parser.IndexExpr) (interface{}, error) {
+	f.expr(i.Object)
+	f.write("[")
+	f.expr(i.Index)
+	f.write("]")
+	return nil, nil
+}
+
+func (f *formatter) VisitIndexSetExpr(i *parser.IndexSetExpr) (interface{}, error) {
+	f.expr(i.Object)
+	f.write("[")
+	f.expr(i.Index)
+	f.write("] = ")
+	f.expr(i.Value)
+	return nil, nil
+}
+
+func (f *formatter) VisitMapExpr(m *parser.MapExpr) (interface{}, error) {
+	f.write("{")
+	for k := range m.Keys {
+		if k > 0 {
+			f.write(", ")
+		}
+		f.expr(m.Keys[k])
+		f.write(": ")
+		f.expr(m.Values[k])
+	}
+	f.write("}")
+	return nil, nil
+}
+
+// VisitFunctionExpr writes arrow functions whose body is an expression the
+// way they were written, since the parser wraps that expression in a
+// synthesized block and return statement.
+func (f *formatter) VisitFunctionExpr(fn *parser.FunctionExpr) (interface{}, error) {
+	if fn.Arrow == nil {
+		f.write("fun ")
+		f.params(fn.Params)
+		f.write(" ")
+		f.block(fn.Body.Open.End, fn.Body.Close, fn.Body.Statements)
+		return nil, nil
+	}
+
+	f.params(fn.Params)
+	f.write(" => ")
+	if fn.Body.Open == nil {
+		f.expr(fn.Body.Statements[0].(*parser.ReturnStmt).Value)
+	} else {
+		f.block(fn.Body.Open.End, fn.Body.Close, fn.Body.Statements)
+	}
+	return nil, nil
+}
+
+func (f *formatter) VisitExprStmt(e *parser.ExprStmt) (interface{}, error) {
+	f.expr(e.Expression)
+	f.write(";")
+	return nil, nil
+}
+
+func (f *formatter) VisitPrintStmt(p *parser.PrintStmt) (interface{}, error) {
+	f.write("print ")
+	f.expr(p.Expression)
+	f.write(";")
+	return nil, nil
+}
+
+func (f *formatter) VisitVarStmt(v *parser.VarStmt) (interface{}, error) {
+	f.write("var " + v.Name.Lexeme)
+	if v.Initializer != nil {
+		f.write(" = ")
+		f.expr(v.Initializer)
+	}
+	f.write(";")
+	return nil, nil
+}
+
+func (f *formatter) VisitBlockStmt(b *parser.BlockStmt) (interface{}, error) {
+	if w, ok := forInit(b); ok {
+		f.forStmt(b.Statements[0], w)
+		return nil, nil
+	}
+
+	f.block(b.Open.End, b.Close, b.Statements)
+	return nil, nil
+}
+
+func (f *formatter) VisitIfStmt(i *parser.IfStmt) (interface{}, error) {
+	f.write("if (")
+	f.expr(i.Condition)
+	f.write(")")
+	f.body(i.ThenBranch)
+	if i.ElseBranch == nil {
+		return nil, nil
+	}
+
+	then := i.ThenBranch.Span()
+	if b, ok := i.ThenBranch.(*parser.BlockStmt); ok && b.Open != nil && !f.commented(then.End, i.ElseBranch.Span().Start) {
+		f.write(" else")
+	} else {
+		f.trailing(then.End, i.ElseBranch.Span().Start)
+		f.write("\n")
+		f.indent()
+		f.write("else")
+	}
+
+	f.body(i.ElseBranch)
+	return nil, nil
+}
+
+func (f *formatter) VisitWhileStmt(w *parser.WhileStmt) (interface{}, error) {
+	if forLoop(w) {
+		f.forStmt(nil, w)
+		return nil, nil
+	}
+
+	f.write("while (")
+	f.expr(w.Condition)
+	f.write(")")
+	f.body(w.Body)
+	return nil, nil
+}
+
+func (f *formatter) VisitFunStmt(fn *parser.FunStmt) (interface{}, error) {
+	if fn.Keyword != nil {
+		f.write("fun ")
+	}
+	f.write(fn.Name.Lexeme)
+	f.params(fn.Params)
+	f.write(" ")
+	f.block(fn.Body.Open.End, fn.Body.Close, fn.Body.Statements)
+	return nil, nil
+}
+
+func (f *formatter) VisitReturnStmt(r *parser.ReturnStmt) (interface{}, error) {
+	f.write("return")
+	if r.Value != nil {
+		f.write(" ")
+		f.expr(r.Value)
+	}
+	f.write(";")
+	return nil, nil
+}
+
+func (f *formatter) VisitClassStmt(c *parser.ClassStmt) (interface{}, error) {
+	f.write("class " + c.Name.Lexeme)
+	if c.Super != nil {
+		f.write(" < " + c.Super.Name.Lexeme)
+	}
+	f.write(" ")
+
+	methods := make([]parser.Stmt, len(c.Methods))
+	for k, method := range c.Methods {
+		methods[k] = method
+	}
+	header := c.Name.End
+	if c.Super != nil {
+		header = c.Super.Name.End
+	}
+	f.block(header, c.Close, methods)
+	return nil, nil
+}
+
+func (f *formatter) VisitBreakStmt(b *parser.BreakStmt) (interface{}, error) {
+	f.write("break;")
+	return nil, nil
+}
+
+func (f *formatter) VisitContinueStmt(c *parser.ContinueStmt) (interface{}, error) {
+	f.write("continue;")
+	return nil, nil
+}
+
+func (f *formatter) VisitImportStmt(i *parser.ImportStmt) (interface{}, error) {
+	f.write("import " + i.Path.Lexeme + " as " + i.Name.Lexeme + ";")
+	return nil, nil
+}
+
+func (f *formatter) VisitExportStmt(e *parser.ExportStmt) (interface{}, error) {
+	f.write("export ")
+	f.stmt(e.Declaration)
+	return nil, nil
+}
+
+func (f *formatter) VisitThrowStmt(t *parser.ThrowStmt) (interface{}, error) {
+	f.write("throw ")
+	f.expr(t.Value)
+	f.write(";")
+	return nil, nil
+}
+
+func (f *formatter) VisitTryStmt(t *parser.TryStmt) (interface{}, error) {
+	f.write("try ")
+	f.block(t.Body.Open.End, t.Body.Close, t.Body.Statements)
+	if t.Handler != nil {
+		f.write(" catch (" + t.Name.Lexeme + ") ")
+		f.block(t.Handler.Open.End, t.Handler.Close, t.Handler.Statements)
+	}
+	if t.Finally != nil {
+		f.write(" finally ")
+		f.block(t.Finally.Open.End, t.Finally.Close, t.Finally.Statements)
+	}
+	return nil, nil
+}
@@ -0,0 +1,69 @@
+package format
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// TestGolden formats every testdata/*.lox file, compares the result with the
+// .golden file next to it and checks that formatting the result again
+// changes nothing.
+func TestGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.lox"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("no test inputs: %v", err)
+	}
+
+	for _, input := range inputs {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			src, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			formatted, err := Source(string(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := strings.TrimSuffix(input, ".lox") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(formatted), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if formatted != string(want) {
+				t.Errorf("formatted %s differs from %s:\n%s", input, golden, formatted)
+			}
+
+			again, err := Source(formatted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != formatted {
+				t.Errorf("formatting the output again changed it:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	src := "print (1;\n"
+	formatted, err := Source(src)
+	if err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	if formatted != src {
+		t.Errorf("got %q, want the source unchanged", formatted)
+	}
+}
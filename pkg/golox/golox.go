@@ -0,0 +1,150 @@
+// Package golox embeds the Lox interpreter in Go programs.
+//
+//	vm := golox.New(golox.Options{Stdout: &buf})
+//	vm.SetGlobal("limit", 10.0)
+//	value, err := vm.Eval("limit * 2;")
+//
+// Values crossing the boundary are plain Go values: nil, bool, float64 and
+// string, plus opaque values such as functions, classes, instances, lists
+// and maps that can only be passed back into the same VM. Go functions become
+// Lox natives through Register, and Go slices and maps they return become
+// lists and maps.
+package golox
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golox/pkg/fault"
+	"golox/pkg/interpreter"
+	"golox/pkg/parser"
+	"golox/pkg/resolver"
+)
+
+type Value = interface{}
+
+type NativeFunction = interpreter.NativeFunction
+
+type Limits = interpreter.Limits
+
+// Error is returned by Eval and Call when a Lox program fails at runtime. Its
+// Trace field lists the Lox call stack, innermost call first. Uncaught throw
+// statements have the code fault.THROWN_VALUE and the thrown value in Value.
+type Error = fault.Fault
+
+type Options struct {
+	// Stdout receives the output of print statements. Defaults to os.Stdout.
+	Stdout io.Writer
+
+	// ModulePath lists the directories searched for imported modules after
+	// the directory of the importing file, which is the working directory
+	// for code run by Eval.
+	ModulePath []string
+
+	// ReadModule reads the source of an imported module. It must return an
+	// error wrapping fs.ErrNotExist for missing files. Defaults to
+	// os.ReadFile.
+	ReadModule func(path string) ([]byte, error)
+
+	// Limits restrict the time, steps, call depth and allocations of every
+	// call to Eval and Call, for running untrusted scripts. Exceeding one
+	// fails with an Error with the code fault.LIMIT_EXCEEDED, except for the
+	// call depth which is a catchable stack overflow error.
+	Limits Limits
+}
+
+// VM is a Lox interpreter whose global state persists across calls to Eval
+// and Call. It is not safe for concurrent use.
+type VM struct {
+	i *interpreter.Interpreter
+}
+
+func New(opts Options) *VM {
+	i := interpreter.NewInterpreter()
+	if opts.Stdout != nil {
+		i.SetOutput(opts.Stdout)
+	} else {
+		i.SetOutput(os.Stdout)
+	}
+
+	i.SetLimits(opts.Limits)
+	i.SetModulePath(opts.ModulePath)
+	if opts.ReadModule != nil {
+		i.SetModuleReader(opts.ReadModule)
+	}
+
+	return &VM{i}
+}
+
+// SetGlobal defines a global variable. Go numbers are converted to Lox
+// numbers.
+func (vm *VM) SetGlobal(name string, value Value) {
+	vm.i.Define(name, interpreter.ToLox(value))
+}
+
+// Register exposes the Go function fn to Lox as a global called name. See
+// interpreter.NewGoFunc for the supported signatures.
+func (vm *VM) Register(name string, fn interface{}) error {
+	native, err := interpreter.NewGoFunc(name, fn)
+	if err != nil {
+		return err
+	}
+
+	vm.i.DefineNative(native)
+	return nil
+}
+
+// RegisterNative exposes a hand written native function to Lox.
+func (vm *VM) RegisterNative(fn NativeFunction) {
+	vm.i.DefineNative(fn)
+}
+
+func (vm *VM) Global(name string) (Value, bool) {
+	return vm.i.Global(name)
+}
+
+// Eval runs src and returns the value of its last statement when that is an
+// expression statement, so Eval("1 + 2;") yields 3. Compile errors are
+// returned as a fault.List and runtime errors as a *fault.Fault; use
+// fault.Diagnostics to handle both uniformly.
+func (vm *VM) Eval(src string) (Value, error) {
+	stmts, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resolver.NewResolver().Resolve(stmts)
+	if err != nil {
+		return nil, err
+	}
+
+	return vm.i.Eval(stmts, res)
+}
+
+// Call invokes the global function or class called fnName.
+func (vm *VM) Call(fnName string, args ...Value) (Value, error) {
+	callee, ok := vm.i.Global(fnName)
+	if !ok {
+		return nil, fmt.Errorf("undefined function %s", fnName)
+	}
+
+	// the caller's slice keeps its Go values
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = interpreter.ToLox(arg)
+	}
+
+	return vm.i.Call(callee, values)
+}
+
+// Parse scans and parses src without running it. The error lists every
+// syntax error in src.
+func Parse(src string) ([]parser.Stmt, error) {
+	return parser.ParseSource(src)
+}
+
+// String formats a value the way Lox's print statement does.
+func String(value Value) string {
+	return interpreter.Stringify(value)
+}
@@ -0,0 +1,51 @@
+package interpreter_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golox/pkg/interpreter"
+	"golox/pkg/parser"
+	"golox/pkg/resolver"
+)
+
+// benchmark runs one of the scripts in bench/ on the tree interpreter.
+func benchmark(b *testing.B, script string) {
+	src, err := os.ReadFile(filepath.Join("..", "..", "bench", script))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	stmts, err := parser.ParseSource(string(src))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	res, err := resolver.NewResolver().Resolve(stmts)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		i := interpreter.NewInterpreter()
+		i.SetOutput(io.Discard)
+		if err := i.Interpret(stmts, res); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	benchmark(b, "fib.lox")
+}
+
+func BenchmarkLoops(b *testing.B) {
+	benchmark(b, "loops.lox")
+}
+
+func BenchmarkMethods(b *testing.B) {
+	benchmark(b, "methods.lox")
+}
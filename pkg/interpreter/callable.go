@@ -2,77 +2,72 @@ package interpreter
 
 import (
 	"fmt"
-	"time"
 
+	"golox/pkg/fault"
 	"golox/pkg/parser"
+	"golox/pkg/scanner"
 )
 
+// callable is implemented by every value Lox code can call. paren is the
+// closing parenthesis of the call expression, or nil when the call comes
+// from Go. An arity of -1 accepts any number of arguments.
 type callable interface {
 	arity() int
-	call(i *Interpreter, args []interface{}) interface{}
-}
-
-type clock struct{}
-
-func (c *clock) arity() int { return 0 }
-
-func (c *clock) call(i *Interpreter, args []interface{}) interface{} {
-	return float64(time.Now().UnixMilli() / 1000)
-}
-
-func (c clock) String() string {
-	return "<native function clock>"
+	call(i *Interpreter, paren *scanner.Token, args []interface{}) (interface{}, error)
 }
 
+// function is a declared function, a method or, when name is empty, an
+// anonymous function. It runs with the globals of the module declaring it.
 type function struct {
-	declaration *parser.FunStmt
-	closure     *environment
-	init        bool
+	name    string
+	params  []*scanner.Token
+	body    *parser.BlockStmt
+	closure *environment
+	init    bool
+	module  *module
 }
 
-func (f *function) arity() int { return len(f.declaration.Params) }
+func (f *function) arity() int { return len(f.params) }
 
-func (f *function) call(i *Interpreter, args []interface{}) (value interface{}) {
-	env := &environment{f.closure, make(map[string]interface{})}
-	for i := 0; i < f.arity(); i++ {
-		env.define(f.declaration.Params[i].Lexeme, args[i])
-	}
+func (f *function) call(i *Interpreter, paren *scanner.Token, args []interface{}) (interface{}, error) {
+	// the parameters take the first slots of the function's scope
+	env := &environment{f.closure, args}
 
-	prev := i.current
-	defer func() {
-		i.current = prev
-		r := recover()
-		if err, ok := r.(error); ok {
-			panic(err)
-		} else {
-			if f.init {
-				value = f.closure.getAt("this", 0)
-			} else {
-				value = r
-			}
+	prev := i.module
+	i.module = f.module
+	c, err := i.executeBlock(f.body.Statements, env)
+	if err != nil {
+		// trace while the module is known, for the file names of the frames
+		if f, ok := err.(*fault.Fault); ok {
+			i.trace(f)
 		}
-	}()
-
-	i.current = env
-	for _, stmt := range f.declaration.Body.Statements {
-		stmt.Accept(i)
+		i.module = prev
+		return nil, err
 	}
+	i.module = prev
 
 	if f.init {
-		return f.closure.getAt("this", 0)
+		return f.closure.getAt(0, 0), nil
 	}
 
-	return value
+	if c != nil {
+		return c.(*completion).value, nil
+	}
+
+	return nil, nil
 }
 
 func (f *function) bind(i *instance) *function {
-	env := &environment{f.closure, make(map[string]interface{})}
-	env.define("this", i)
-	return &function{f.declaration, env, f.init}
+	env := &environment{f.closure, []interface{}{i}}
+	return &function{f.name, f.params, f.body, env, f.init, f.module}
 }
 
 func (f function) String() string {
-	return fmt.Sprintf("<function %s>", f.declaration.Name.Lexeme)
+	if f.name == "" {
+		return "<function>"
+	}
+
+	return fmt.Sprintf("<function %s>", f.name)
 }
 
 type class struct {
@@ -90,14 +85,24 @@ func (c *class) arity() int {
 	return 0
 }
 
-func (c *class) call(i *Interpreter, args []interface{}) interface{} {
+func (c *class) call(i *Interpreter, paren *scanner.Token, args []interface{}) (interface{}, error) {
+	span := scanner.Span{}
+	if paren != nil {
+		span = paren.Span()
+	}
+	if err := i.allocate(span); err != nil {
+		return nil, err
+	}
+
 	inst := &instance{c, make(map[string]interface{})}
 	initializer := c.findMethod("init")
 	if initializer != nil {
-		initializer.bind(inst).call(i, args)
+		if _, err := initializer.bind(inst).call(i, paren, args); err != nil {
+			return nil, err
+		}
 	}
 
-	return inst
+	return inst, nil
 }
 
 func (c *class) findMethod(name string) *function {
@@ -114,4 +119,4 @@ func (c *class) findMethod(name string) *function {
 
 func (c class) String() string {
 	return fmt.Sprintf("<class %s>", c.name)
-}
\ No newline at end of file
+}
@@ -0,0 +1,174 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"golox/pkg/scanner"
+)
+
+// dict is a Lox map. Keys are strings, numbers other than NaN, booleans or
+// nil and are kept in insertion order so that keys and values iterate
+// predictably.
+type dict struct {
+	keys   []interface{}
+	values map[interface{}]interface{}
+}
+
+func newDict() *dict {
+	return &dict{nil, make(map[interface{}]interface{})}
+}
+
+func (d *dict) lookup(key interface{}) (interface{}, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+
+	value, ok := d.values[key]
+	if !ok {
+		return nil, fmt.Errorf("undefined key %s", nested(key, nil))
+	}
+
+	return value, nil
+}
+
+func (d *dict) set(key interface{}, value interface{}) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	if _, ok := d.values[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+
+	d.values[key] = value
+	return nil
+}
+
+func (d *dict) delete(key interface{}) (interface{}, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+
+	value, ok := d.values[key]
+	if !ok {
+		return nil, nil
+	}
+
+	delete(d.values, key)
+	for k, existing := range d.keys {
+		if existing == key {
+			d.keys = append(d.keys[:k], d.keys[k+1:]...)
+			break
+		}
+	}
+
+	return value, nil
+}
+
+// get looks up a map method. Methods are natives bound to the map.
+func (d *dict) get(i *Interpreter, name *scanner.Token) (interface{}, error) {
+	var fn NativeFunction
+	switch name.Lexeme {
+	case "size":
+		fn = NewNativeFunc("size", 0, func(args []interface{}) (interface{}, error) {
+			return float64(len(d.keys)), nil
+		})
+	case "keys":
+		fn = NewNativeFunc("keys", 0, func(args []interface{}) (interface{}, error) {
+			if err := i.allocate(name.Span()); err != nil {
+				return nil, err
+			}
+
+			keys := make([]interface{}, len(d.keys))
+			copy(keys, d.keys)
+			return &list{keys}, nil
+		})
+	case "values":
+		fn = NewNativeFunc("values", 0, func(args []interface{}) (interface{}, error) {
+			if err := i.allocate(name.Span()); err != nil {
+				return nil, err
+			}
+
+			values := make([]interface{}, len(d.keys))
+			for k, key := range d.keys {
+				values[k] = d.values[key]
+			}
+			return &list{values}, nil
+		})
+	case "has":
+		fn = NewNativeFunc("has", 1, func(args []interface{}) (interface{}, error) {
+			if err := checkKey(args[0]); err != nil {
+				return nil, err
+			}
+
+			_, ok := d.values[args[0]]
+			return ok, nil
+		})
+	case "delete":
+		fn = NewNativeFunc("delete", 1, func(args []interface{}) (interface{}, error) {
+			return d.delete(args[0])
+		})
+	default:
+		message := fmt.Sprintf("undefined property %s", name.Lexeme)
+		return nil, faultAt(name.Span(), message)
+	}
+
+	return &native{fn}, nil
+}
+
+func checkKey(key interface{}) error {
+	switch k := key.(type) {
+	case float64:
+		// NaN is not equal to itself, so it could never be found again
+		if math.IsNaN(k) {
+			return fmt.Errorf("map key must not be NaN")
+		}
+		return nil
+	case nil, bool, string:
+		return nil
+	}
+
+	return fmt.Errorf("map key must be a string, number, boolean or nil but got %s", TypeName(key))
+}
+
+func (d *dict) String() string {
+	return nested(d, make(map[interface{}]bool))
+}
+
+// nested formats a list, map or a value inside of one, where strings are
+// shown in quotes. seen holds the containers being formatted so that cycles
+// are printed as [...] or {...}.
+func nested(value interface{}, seen map[interface{}]bool) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case *list:
+		if seen[v] {
+			return "[...]"
+		}
+		seen[v] = true
+		defer delete(seen, v)
+
+		elements := make([]string, len(v.elements))
+		for k, element := range v.elements {
+			elements[k] = nested(element, seen)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *dict:
+		if seen[v] {
+			return "{...}"
+		}
+		seen[v] = true
+		defer delete(seen, v)
+
+		entries := make([]string, len(v.keys))
+		for k, key := range v.keys {
+			entries[k] = nested(key, seen) + ": " + nested(v.values[key], seen)
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	}
+
+	return Stringify(value)
+}
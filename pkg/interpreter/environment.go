@@ -3,57 +3,139 @@ package interpreter
 import (
 	"fmt"
 
-	"golox/pkg/fault"
 	"golox/pkg/scanner"
 )
 
+// environment holds the local variables of one scope. They are stored in
+// the slots the resolver assigned them, which follow declaration order, so
+// defining a variable appends it.
 type environment struct {
 	enclosing *environment
-	values    map[string]interface{}
+	values    []interface{}
 }
 
-func (e *environment) get(name *scanner.Token) interface{} {
-	if value, ok := e.values[name.Lexeme]; ok {
-		return value
+func (e *environment) ancestor(dist int) *environment {
+	ancestor := e
+	for i := 0; i < dist; i++ {
+		ancestor = ancestor.enclosing
+	}
+
+	return ancestor
+}
+
+func (e *environment) getAt(dist int, slot int) interface{} {
+	return e.ancestor(dist).values[slot]
+}
+
+func (e *environment) assignAt(dist int, slot int, value interface{}) {
+	e.ancestor(dist).values[slot] = value
+}
+
+func (e *environment) define(value interface{}) {
+	e.values = append(e.values, value)
+}
+
+// GLOBAL is the depth of the globals in Interpreter.locals, whose slot is
+// then an index into the globals of the module the expression is part of.
+const GLOBAL = -1
+
+// undefined fills the slots of globals that are referred to but not defined
+// yet.
+type undefined struct{}
+
+// globals holds the global variables of a module. Every name gets a slot
+// when it is first defined or referred to, so that references index values
+// rather than look the name up each time. Variables that a module does not
+// define are looked up in the enclosing builtins.
+type globals struct {
+	enclosing *globals
+	slots     map[string]int
+	names     []string
+	values    []interface{}
+}
+
+func newGlobals(enclosing *globals) *globals {
+	return &globals{enclosing, make(map[string]int), nil, nil}
+}
+
+// slot returns the slot of a name, making one if there is none yet.
+func (g *globals) slot(name string) int {
+	if slot, ok := g.slots[name]; ok {
+		return slot
+	}
+
+	g.slots[name] = len(g.values)
+	g.names = append(g.names, name)
+	g.values = append(g.values, undefined{})
+	return len(g.values) - 1
+}
+
+// lookup returns the value of the variable called name, if it is defined.
+func (g *globals) lookup(name string) (interface{}, bool) {
+	slot, ok := g.slots[name]
+	if !ok || g.values[slot] == (undefined{}) {
+		return nil, false
+	}
+
+	return g.values[slot], true
+}
+
+func (g *globals) get(name *scanner.Token) (interface{}, error) {
+	if value, ok := g.lookup(name.Lexeme); ok {
+		return value, nil
 	}
 
-	if e.enclosing != nil {
-		return e.enclosing.get(name)
+	if g.enclosing != nil {
+		return g.enclosing.get(name)
 	}
 
 	message := fmt.Sprintf("undefined variable %s", name.Lexeme)
-	panic(fault.NewFault(name.Line, message))
+	return nil, faultAt(name.Span(), message)
 }
 
-func (e *environment) getAt(name string, dist int) interface{} {
-	ancestor := e
-	for i := 0; i < dist; i++ {
-		ancestor = ancestor.enclosing
+func (g *globals) getAt(slot int, name *scanner.Token) (interface{}, error) {
+	if value := g.values[slot]; value != (undefined{}) {
+		return value, nil
 	}
 
-	return ancestor.values[name]
+	return g.get(name)
 }
 
-func (e *environment) assign(name *scanner.Token, value interface{}) {
-	if _, ok := e.values[name.Lexeme]; ok {
-		e.values[name.Lexeme] = value
-	} else if e.enclosing != nil {
-		e.enclosing.assign(name, value)
-	} else {
-		message := fmt.Sprintf("undefined variable %s", name.Lexeme)
-		panic(fault.NewFault(name.Line, message))
+func (g *globals) assign(name *scanner.Token, value interface{}) error {
+	if slot, ok := g.slots[name.Lexeme]; ok && g.values[slot] != (undefined{}) {
+		g.values[slot] = value
+		return nil
+	}
+
+	if g.enclosing != nil {
+		return g.enclosing.assign(name, value)
 	}
+
+	message := fmt.Sprintf("undefined variable %s", name.Lexeme)
+	return faultAt(name.Span(), message)
 }
 
-func (e *environment) assignAt(name string, value interface{}, dist int) {
-	ancestor := e
-	for i := 0; i < dist; i++ {
-		ancestor = ancestor.enclosing
+func (g *globals) assignAt(slot int, name *scanner.Token, value interface{}) error {
+	if g.values[slot] != (undefined{}) {
+		g.values[slot] = value
+		return nil
 	}
 
-	ancestor.values[name] = value
+	return g.assign(name, value)
 }
 
-func (e *environment) define(name string, value interface{}) {
-	e.values[name] = value
-}
\ No newline at end of file
+func (g *globals) define(name string, value interface{}) {
+	g.values[g.slot(name)] = value
+}
+
+// defined returns the names of the variables that are defined.
+func (g *globals) defined() []string {
+	names := []string{}
+	for slot, name := range g.names {
+		if g.values[slot] != (undefined{}) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
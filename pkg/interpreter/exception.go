@@ -0,0 +1,38 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"golox/pkg/fault"
+	"golox/pkg/scanner"
+)
+
+// exception is the error object a catch clause binds. It wraps a runtime
+// error or a thrown value together with where it was raised.
+type exception struct {
+	f *fault.Fault
+}
+
+func (e *exception) get(name *scanner.Token) (interface{}, error) {
+	switch name.Lexeme {
+	case "message":
+		return e.f.Message, nil
+	case "line":
+		return float64(e.f.Line), nil
+	case "stack":
+		stack := make([]interface{}, len(e.f.Trace))
+		for k, frame := range e.f.Trace {
+			stack[k] = frame.String()
+		}
+		return &list{stack}, nil
+	case "value":
+		return e.f.Value, nil
+	}
+
+	message := fmt.Sprintf("undefined property %s", name.Lexeme)
+	return nil, faultAt(name.Span(), message)
+}
+
+func (e exception) String() string {
+	return fmt.Sprintf("<error %s>", e.f.Message)
+}
@@ -2,7 +2,7 @@ package interpreter
 
 import (
 	"fmt"
-	"golox/pkg/fault"
+
 	"golox/pkg/scanner"
 )
 
@@ -11,18 +11,18 @@ type instance struct {
 	fields map[string]interface{}
 }
 
-func (i *instance) get(name *scanner.Token) interface{} {
+func (i *instance) get(name *scanner.Token) (interface{}, error) {
 	if value, ok := i.fields[name.Lexeme]; ok {
-		return value
+		return value, nil
 	}
 
 	method := i.c.findMethod(name.Lexeme)
 	if method != nil {
-		return method.bind(i)
+		return method.bind(i), nil
 	}
 
 	message := fmt.Sprintf("undefined property %s", name.Lexeme)
-	panic(fault.NewFault(name.Line, message))
+	return nil, faultAt(name.Span(), message)
 }
 
 func (i *instance) set(name *scanner.Token, value interface{}) {
@@ -31,4 +31,4 @@ func (i *instance) set(name *scanner.Token, value interface{}) {
 
 func (i instance) String() string {
 	return fmt.Sprintf("%s instance", i.c.name)
-}
\ No newline at end of file
+}
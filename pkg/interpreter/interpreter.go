@@ -2,142 +2,329 @@ package interpreter
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 
 	"golox/pkg/fault"
 	"golox/pkg/parser"
+	"golox/pkg/resolver"
 	"golox/pkg/scanner"
 )
 
-
+// Interpreter runs a script and the modules it imports. Natives live in
+// builtins, which encloses the globals of every module. current is nil at
+// the top level of a module, where variables are globals.
 type Interpreter struct {
-	global  *environment
-	current *environment
-	locals  map[parser.Expr]int
+	builtins *globals
+	module   *module
+	current  *environment
+	locals   map[parser.Expr]resolver.Local
+	out      io.Writer
+	frames   []frame
+	loader   *loader
+
+	limits      Limits
+	steps       int
+	allocations int
+}
+
+// completion is returned by a statement that transfers control instead of
+// completing normally, in which case statements return nil. Runtime errors
+// are returned as the error result.
+type completion struct {
+	signal int
+	value  interface{}
+}
+
+const (
+	S_RETURN = iota
+	S_BREAK
+	S_CONTINUE
+)
+
+var (
+	breaking   = &completion{S_BREAK, nil}
+	continuing = &completion{S_CONTINUE, nil}
+)
+
+// frame is a call in progress, or a module whose top level code is running.
+// site is the call expression or import path, or empty for calls made from
+// Go, and file is the path of the module containing it.
+type frame struct {
+	callee interface{}
+	site   scanner.Span
+	file   string
 }
 
 func NewInterpreter() *Interpreter {
-	global := &environment{nil, make(map[string]interface{})}
-	global.define("clock", &clock{})
-	return &Interpreter{global, global, make(map[parser.Expr]int)}
+	builtins := newGlobals(nil)
+	builtins.define("clock", &native{clock})
+	main := newModule("", builtins)
+	main.loading = false
+	return &Interpreter{builtins, main, nil, make(map[parser.Expr]resolver.Local), os.Stdout, nil, newLoader(), Limits{MaxDepth: DEFAULT_MAX_DEPTH}, 0, 0}
 }
 
-func (i *Interpreter) Interpret(stmts []parser.Stmt) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = r.(error)
-		}
-	}()
+// SetOutput redirects the output of print statements, which goes to
+// os.Stdout by default.
+func (i *Interpreter) SetOutput(w io.Writer) {
+	i.out = w
+}
 
+// Interpret runs stmts using the resolution the resolver produced for them.
+// Resolutions accumulate, so that functions declared by earlier calls keep
+// working, except for the parts about top level code, which are dropped
+// once it has run.
+func (i *Interpreter) Interpret(stmts []parser.Stmt, res *resolver.Resolution) error {
+	_, err := i.Eval(stmts, res)
+	return err
+}
+
+// Eval executes stmts like Interpret and returns the value of the last
+// statement if it is an expression statement, or nil otherwise.
+func (i *Interpreter) Eval(stmts []parser.Stmt, res *resolver.Resolution) (interface{}, error) {
+	i.bind(res, i.module.globals)
+	defer i.unbind(res)
+	i.start()
+	var value interface{}
 	for _, stmt := range stmts {
-		stmt.Accept(i)
+		err := i.step(stmt)
+		if err == nil {
+			if e, ok := stmt.(*parser.ExprStmt); ok {
+				value, err = e.Expression.Accept(i)
+			} else {
+				value = nil
+				_, err = stmt.Accept(i)
+			}
+		}
+
+		if err != nil {
+			if f, ok := err.(*fault.Fault); ok {
+				i.trace(f)
+			}
+			return nil, err
+		}
 	}
 
-	return
+	return value, nil
 }
 
-func (i *Interpreter) Resolve(expr parser.Expr, depth int) {
-	i.locals[expr] = depth
+// Call invokes a Lox function, class or bound method with the given
+// arguments.
+func (i *Interpreter) Call(callee interface{}, args []interface{}) (interface{}, error) {
+	// natives calling back into Lox share the call site of the native
+	site := scanner.Span{}
+	if len(i.frames) > 0 {
+		site = i.frames[len(i.frames)-1].site
+	}
+
+	f, ok := callee.(callable)
+	if !ok {
+		return nil, fault.NewFault(site.Line, fmt.Sprintf("%s is not callable", Stringify(callee)))
+	}
+
+	if f.arity() >= 0 && len(args) != f.arity() {
+		return nil, fault.NewFault(site.Line, fmt.Sprintf("expected %d arguments but got %d", f.arity(), len(args)))
+	}
+
+	i.start()
+
+	// the arguments become the callee's locals, which must not grow into
+	// the caller's array
+	return i.call(f, site, nil, args[:len(args):len(args)])
 }
 
-func (i *Interpreter) VisitExprStmt(e *parser.ExprStmt) interface{} {
-	e.Expression.Accept(i)
-	return nil
+// DefineNative makes a Go function available to Lox code as a global.
+func (i *Interpreter) DefineNative(fn NativeFunction) {
+	i.builtins.define(fn.Name(), &native{fn})
 }
 
-func (i *Interpreter) VisitPrintStmt(p *parser.PrintStmt) interface{} {
-	value := p.Expression.Accept(i)
-	switch v := value.(type) {
-	case float64:
-		fmt.Println(strconv.FormatFloat(v, 'f', -1, 64))
-	case bool:
-		fmt.Println(strconv.FormatBool(v))
-	default:
-		fmt.Println(v)
+// Define creates or overwrites a global variable.
+func (i *Interpreter) Define(name string, value interface{}) {
+	i.module.globals.define(name, value)
+}
+
+// Global returns the value of a global variable and whether it exists.
+func (i *Interpreter) Global(name string) (interface{}, bool) {
+	if value, ok := i.module.globals.lookup(name); ok {
+		return value, true
 	}
 
-	return nil
+	return i.builtins.lookup(name)
 }
 
-func (i *Interpreter) VisitVarStmt(v *parser.VarStmt) interface{} {
-	var value interface{}
-	if v.Initializer != nil {
-		value = v.Initializer.Accept(i)
+// Globals returns the names of the global variables of the script, natives
+// included, in alphabetical order.
+func (i *Interpreter) Globals() []string {
+	names := []string{}
+	for _, g := range []*globals{i.module.globals, i.builtins} {
+		for _, name := range g.defined() {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
 	}
 
-	i.current.define(v.Name.Lexeme, value)
-	return nil
+	sort.Strings(names)
+	return names
 }
 
-func (i *Interpreter) VisitBlockStmt(b *parser.BlockStmt) interface{} {
-	prev := i.current
-	defer func() { i.current = prev }()
+// bind records where the variables of a program live. g holds the globals
+// of the module the program is.
+func (i *Interpreter) bind(res *resolver.Resolution, g *globals) {
+	for expr, local := range res.Locals {
+		i.locals[expr] = local
+	}
+
+	for expr, name := range res.Globals {
+		i.locals[expr] = resolver.Local{Depth: GLOBAL, Slot: g.slot(name)}
+	}
+}
+
+// unbind forgets the locals of top level code that has finished running, so
+// that a long REPL session does not keep every input alive.
+func (i *Interpreter) unbind(res *resolver.Resolution) {
+	for _, expr := range res.TopLevel {
+		delete(i.locals, expr)
+	}
+}
+
+func (i *Interpreter) VisitExprStmt(e *parser.ExprStmt) (interface{}, error) {
+	_, err := e.Expression.Accept(i)
+	return nil, err
+}
+
+func (i *Interpreter) VisitPrintStmt(p *parser.PrintStmt) (interface{}, error) {
+	value, err := p.Expression.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintln(i.out, Stringify(value))
+	return nil, nil
+}
 
-	i.current = &environment{prev, make(map[string]interface{})}
-	for _, stmt := range b.Statements {
-		stmt.Accept(i)
+func (i *Interpreter) VisitVarStmt(v *parser.VarStmt) (interface{}, error) {
+	var value interface{}
+	if v.Initializer != nil {
+		var err error
+		if value, err = v.Initializer.Accept(i); err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	i.define(v.Name.Lexeme, value)
+	return nil, nil
 }
 
-func (i *Interpreter) VisitIfStmt(i_ *parser.IfStmt) interface{} {
-	value := i_.Condition.Accept(i)
+func (i *Interpreter) VisitBlockStmt(b *parser.BlockStmt) (interface{}, error) {
+	return i.executeBlock(b.Statements, &environment{i.current, nil})
+}
+
+func (i *Interpreter) VisitIfStmt(i_ *parser.IfStmt) (interface{}, error) {
+	value, err := i_.Condition.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
 	if isTruthy(value) {
-		i_.ThenBranch.Accept(i)
+		return i_.ThenBranch.Accept(i)
 	} else if i_.ElseBranch != nil {
-		i_.ElseBranch.Accept(i)
+		return i_.ElseBranch.Accept(i)
 	}
 
-	return nil
+	return nil, nil
 }
 
-func (i *Interpreter) VisitWhileStmt(w *parser.WhileStmt) interface{} {
-	for isTruthy(w.Condition.Accept(i)) {
-		w.Body.Accept(i)
-	}
+func (i *Interpreter) VisitWhileStmt(w *parser.WhileStmt) (interface{}, error) {
+	for {
+		if err := i.step(w); err != nil {
+			return nil, err
+		}
+
+		value, err := w.Condition.Accept(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isTruthy(value) {
+			return nil, nil
+		}
+
+		c, err := w.Body.Accept(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if c != nil {
+			switch c.(*completion).signal {
+			case S_BREAK:
+				return nil, nil
+			case S_RETURN:
+				return c, nil
+			}
+		}
 
-	return nil
+		if w.Increment != nil {
+			if _, err := w.Increment.Accept(i); err != nil {
+				return nil, err
+			}
+		}
+	}
 }
 
-func (i *Interpreter) VisitFunStmt(f *parser.FunStmt) interface{} {
-	fn := &function{f, i.current, false}
-	i.current.define(f.Name.Lexeme, fn)
-	return nil
+func (i *Interpreter) VisitFunStmt(f *parser.FunStmt) (interface{}, error) {
+	if err := i.allocate(f.Name.Span()); err != nil {
+		return nil, err
+	}
+
+	fn := &function{f.Name.Lexeme, f.Params, f.Body, i.current, false, i.module}
+	i.define(f.Name.Lexeme, fn)
+	return nil, nil
 }
 
-func (i *Interpreter) VisitReturnStmt(v *parser.ReturnStmt) interface{} {
+func (i *Interpreter) VisitReturnStmt(r *parser.ReturnStmt) (interface{}, error) {
 	var value interface{}
-	if v.Value != nil {
-		value = v.Value.Accept(i)
+	if r.Value != nil {
+		var err error
+		if value, err = r.Value.Accept(i); err != nil {
+			return nil, err
+		}
 	}
 
-	panic(value)
+	return &completion{S_RETURN, value}, nil
 }
 
-func (i *Interpreter) VisitClassStmt(c *parser.ClassStmt) interface{} {
+func (i *Interpreter) VisitClassStmt(c *parser.ClassStmt) (interface{}, error) {
 	var super *class
 	if c.Super != nil {
-		if value, ok := c.Super.Accept(i).(*class); ok {
-			super = value
+		value, err := c.Super.Accept(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if s, ok := value.(*class); ok {
+			super = s
 		} else {
 			message := fmt.Sprintf("%s is a not a class", c.Super.Name.Lexeme)
-			panic(fault.NewFault(c.Super.Name.Line, message))
+			return nil, faultAt(c.Super.Span(), message)
 		}
 	}
 
-	i.current.define(c.Name.Lexeme, nil)
 	if c.Super != nil {
-		i.current = &environment{i.current, make(map[string]interface{})}
-		i.current.define("super", super)
+		i.current = &environment{i.current, []interface{}{super}}
 	}
 
 	methods := make(map[string]*function)
 	for _, method := range c.Methods {
 		if method.Name.Lexeme == "init" {
-			methods[method.Name.Lexeme] = &function{method, i.current, true}
+			methods[method.Name.Lexeme] = &function{method.Name.Lexeme, method.Params, method.Body, i.current, true, i.module}
 		} else {
-			methods[method.Name.Lexeme] = &function{method, i.current, false}
+			methods[method.Name.Lexeme] = &function{method.Name.Lexeme, method.Params, method.Body, i.current, false, i.module}
 		}
 	}
 
@@ -146,186 +333,530 @@ func (i *Interpreter) VisitClassStmt(c *parser.ClassStmt) interface{} {
 		i.current = i.current.enclosing
 	}
 
-	i.current.assign(c.Name, c_)
-	return nil
+	i.define(c.Name.Lexeme, c_)
+	return nil, nil
+}
+
+func (i *Interpreter) VisitBreakStmt(b *parser.BreakStmt) (interface{}, error) {
+	return breaking, nil
+}
+
+func (i *Interpreter) VisitContinueStmt(c *parser.ContinueStmt) (interface{}, error) {
+	return continuing, nil
+}
+
+// VisitThrowStmt raises value as a fault. Throwing a caught error object
+// raises its fault again, keeping the original stack trace.
+func (i *Interpreter) VisitThrowStmt(t *parser.ThrowStmt) (interface{}, error) {
+	value, err := t.Value.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	if e, ok := value.(*exception); ok {
+		return nil, e.f
+	}
+
+	f := faultAt(t.Value.Span(), Stringify(value))
+	f.Code = fault.THROWN_VALUE
+	f.Value = value
+	return nil, f
+}
+
+// VisitTryStmt catches faults but not compile errors in imported modules.
+// A finally block that does not complete normally replaces the outcome of
+// the rest of the statement. Exceeding a limit skips both catch and finally.
+func (i *Interpreter) VisitTryStmt(t *parser.TryStmt) (interface{}, error) {
+	c, err := t.Body.Accept(i)
+	if f, ok := err.(*fault.Fault); ok && f.Code == fault.LIMIT_EXCEEDED {
+		return nil, err
+	}
+
+	if f, ok := err.(*fault.Fault); ok && t.Handler != nil {
+		// the stack is still intact if the fault did not leave a call
+		i.trace(f)
+		env := &environment{i.current, []interface{}{&exception{f}}}
+		c, err = i.executeBlock(t.Handler.Statements, env)
+	}
+
+	if t.Finally != nil {
+		if fc, ferr := t.Finally.Accept(i); fc != nil || ferr != nil {
+			return fc, ferr
+		}
+	}
+
+	return c, err
 }
 
-func (i *Interpreter) VisitBinaryExpr(b *parser.BinaryExpr) interface{} {
-	left := b.Left.Accept(i)
-	right := b.Right.Accept(i)
+func (i *Interpreter) VisitBinaryExpr(b *parser.BinaryExpr) (interface{}, error) {
+	left, err := b.Left.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := b.Right.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
 	switch b.Operator.TokenType {
 	case scanner.BANG_EQUAL:
-		return left != right
+		return !isEqual(left, right), nil
 	case scanner.EQUAL_EQUAL:
-		return left == right
-	case scanner.GREATER:
-		leftValue, rightValue := i.checkNumberOperands(b.Operator, left, right)
-		return leftValue > rightValue
-	case scanner.GREATER_EQUAL:
-		leftValue, rightValue := i.checkNumberOperands(b.Operator, left, right)
-		return leftValue >= rightValue
-	case scanner.LESS:
-		leftValue, rightValue := i.checkNumberOperands(b.Operator, left, right)
-		return leftValue < rightValue
-	case scanner.LESS_EQUAL:
-		leftValue, rightValue := i.checkNumberOperands(b.Operator, left, right)
-		return leftValue <= rightValue
-	case scanner.MINUS:
-		leftValue, rightValue := i.checkNumberOperands(b.Operator, left, right)
-		return leftValue - rightValue
+		return isEqual(left, right), nil
 	case scanner.PLUS:
 		if leftValue, leftOk := left.(float64); leftOk {
 			if rightValue, rightOk := right.(float64); rightOk {
-				return leftValue + rightValue
+				return leftValue + rightValue, nil
 			}
 		}
 
 		if leftValue, leftOk := left.(string); leftOk {
 			if rightValue, rightOk := right.(string); rightOk {
-				return leftValue + rightValue
+				if err := i.allocate(b.Operator.Span()); err != nil {
+					return nil, err
+				}
+				return leftValue + rightValue, nil
 			}
 		}
 
-		panic(fault.NewFault(b.Operator.Line, "operands must be two numbers or two strings"))
+		f := faultAt(b.Operator.Span(), "operands must be two numbers or two strings")
+		labelOperands(f, b, left, right)
+		return nil, f
+	}
+
+	leftValue, leftOk := left.(float64)
+	rightValue, rightOk := right.(float64)
+	if !leftOk || !rightOk {
+		f := faultAt(b.Operator.Span(), "operands must be numbers")
+		labelOperands(f, b, left, right)
+		return nil, f
+	}
+
+	switch b.Operator.TokenType {
+	case scanner.GREATER:
+		return leftValue > rightValue, nil
+	case scanner.GREATER_EQUAL:
+		return leftValue >= rightValue, nil
+	case scanner.LESS:
+		return leftValue < rightValue, nil
+	case scanner.LESS_EQUAL:
+		return leftValue <= rightValue, nil
+	case scanner.MINUS:
+		return leftValue - rightValue, nil
 	case scanner.SLASH:
-		leftValue, rightValue := i.checkNumberOperands(b.Operator, left, right)
-		return leftValue / rightValue
+		return leftValue / rightValue, nil
 	case scanner.STAR:
-		leftValue, rightValue := i.checkNumberOperands(b.Operator, left, right)
-		return leftValue * rightValue
+		return leftValue * rightValue, nil
 	}
 
-	return nil
+	return nil, nil
 }
 
-func (i *Interpreter) VisitGroupingExpr(g *parser.GroupingExpr) interface{} {
+func (i *Interpreter) VisitGroupingExpr(g *parser.GroupingExpr) (interface{}, error) {
 	return g.Expression.Accept(i)
 }
 
-func (i *Interpreter) VisitLiteralExpr(l *parser.LiteralExpr) interface{} {
-	return l.Value
+func (i *Interpreter) VisitLiteralExpr(l *parser.LiteralExpr) (interface{}, error) {
+	return l.Value, nil
 }
 
-func (i *Interpreter) VisitUnaryExpr(u *parser.UnaryExpr) interface{} {
-	right := u.Right.Accept(i)
+func (i *Interpreter) VisitUnaryExpr(u *parser.UnaryExpr) (interface{}, error) {
+	right, err := u.Right.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
 	if u.Operator.TokenType == scanner.MINUS {
 		if value, ok := right.(float64); ok {
-			return -value
+			return -value, nil
 		}
 
-		panic(fault.NewFault(u.Operator.Line, "operand must be a number"))
+		f := faultAt(u.Operator.Span(), "operand must be a number")
+		label(f, u.Right.Span(), "this is "+article(TypeName(right)))
+		return nil, f
 	}
 
 	if u.Operator.TokenType == scanner.BANG {
-		switch value := right.(type) {
-		case bool:
-			return !value
-		case nil:
-			return true
-		default:
-			return false
-		}
+		return !isTruthy(right), nil
 	}
 
-	return nil
+	return nil, nil
 }
 
-func (i *Interpreter) VisitVariableExpr(v *parser.VariableExpr) interface{} {
-	if dist, ok := i.locals[v]; ok {
-		return i.current.getAt(v.Name.Lexeme, dist)
+func (i *Interpreter) VisitVariableExpr(v *parser.VariableExpr) (interface{}, error) {
+	if l, ok := i.locals[v]; ok && l.Depth != GLOBAL {
+		return i.current.getAt(l.Depth, l.Slot), nil
+	} else if ok {
+		return i.module.globals.getAt(l.Slot, v.Name)
 	}
 
-	return i.global.get(v.Name)
+	return i.module.globals.get(v.Name)
 }
 
-func (i *Interpreter) VisitAssignExpr(a *parser.AssignExpr) interface{} {
-	value := a.Value.Accept(i)
-	if dist, ok := i.locals[a]; ok {
-		i.current.assignAt(a.Name.Lexeme, value, dist)
-	} else {
-		i.global.assign(a.Name, value)
+func (i *Interpreter) VisitAssignExpr(a *parser.AssignExpr) (interface{}, error) {
+	value, err := a.Value.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	if l, ok := i.locals[a]; ok && l.Depth != GLOBAL {
+		i.current.assignAt(l.Depth, l.Slot, value)
+	} else if ok {
+		if err := i.module.globals.assignAt(l.Slot, a.Name, value); err != nil {
+			return nil, err
+		}
+	} else if err := i.module.globals.assign(a.Name, value); err != nil {
+		return nil, err
 	}
 
-	return value
+	return value, nil
 }
 
-func (i *Interpreter) VisitLogicalExpr(l *parser.LogicalExpr) interface{} {
-	left := l.Left.Accept(i)
-	if (l.Operator.TokenType == scanner.OR && isTruthy(left)) || !isTruthy(left) {
-		return left
+func (i *Interpreter) VisitLogicalExpr(l *parser.LogicalExpr) (interface{}, error) {
+	left, err := l.Left.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.Operator.TokenType == scanner.OR {
+		if isTruthy(left) {
+			return left, nil
+		}
+	} else if !isTruthy(left) {
+		return left, nil
 	}
 
 	return l.Right.Accept(i)
 }
 
-func (i *Interpreter) VisitCallExpr(c *parser.CallExpr) interface{} {
-	callee := c.Callee.Accept(i)
-	args := []interface{}{}
-	for _, arg := range c.Arguments {
-		args = append(args, arg.Accept(i))
+func (i *Interpreter) VisitCallExpr(c *parser.CallExpr) (interface{}, error) {
+	callee, err := c.Callee.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]interface{}, len(c.Arguments))
+	for k, arg := range c.Arguments {
+		if args[k], err = arg.Accept(i); err != nil {
+			return nil, err
+		}
 	}
 
 	if f, ok := callee.(callable); ok {
-		if len(args) != f.arity() {
+		if f.arity() >= 0 && len(args) != f.arity() {
 			message := fmt.Sprintf("expected %d arguments but got %d", f.arity(), len(args))
-			panic(fault.NewFault(c.Paren.Line, message))
+			return nil, faultAt(c.Span(), message)
 		}
 
-		return f.call(i, args)
+		return i.call(f, c.Span(), &c.Paren, args)
 	}
 
-	panic(fault.NewFault(c.Paren.Line, "can only call functions and classes"))
+	f := faultAt(c.Span(), "can only call functions and classes")
+	label(f, c.Callee.Span(), "this is "+article(TypeName(callee)))
+	return nil, f
 }
 
-func (i *Interpreter) VisitGetExpr(g *parser.GetExpr) interface{} {
-	object := g.Object.Accept(i)
-	if o, ok := object.(*instance); ok {
+func (i *Interpreter) VisitGetExpr(g *parser.GetExpr) (interface{}, error) {
+	object, err := g.Object.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := object.(type) {
+	case *instance:
+		return o.get(g.Name)
+	case *list:
+		return o.get(i, g.Name)
+	case *dict:
+		return o.get(i, g.Name)
+	case *module:
+		return o.get(g.Name)
+	case *exception:
 		return o.get(g.Name)
 	}
 
-	panic(fault.NewFault(g.Name.Line, "only instances have properties"))
+	f := faultAt(g.Name.Span(), "only instances have properties")
+	label(f, g.Object.Span(), "this is "+article(TypeName(object)))
+	return nil, f
 }
 
-func (i *Interpreter) VisitSetExpr(s *parser.SetExpr) interface{} {
-	object := s.Object.Accept(i)
+func (i *Interpreter) VisitSetExpr(s *parser.SetExpr) (interface{}, error) {
+	object, err := s.Object.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
 	if o, ok := object.(*instance); ok {
-		value := s.Value.Accept(i)
+		value, err := s.Value.Accept(i)
+		if err != nil {
+			return nil, err
+		}
+
 		o.set(s.Name, value)
-		return value
+		return value, nil
 	}
 
-	panic(fault.NewFault(s.Name.Line, "only instances have fields"))
+	f := faultAt(s.Name.Span(), "only instances have fields")
+	label(f, s.Object.Span(), "this is "+article(TypeName(object)))
+	return nil, f
 }
 
-func (i *Interpreter) VisitThisExpr(t *parser.ThisExpr) interface{} {
-	if dist, ok := i.locals[t]; ok {
-		return i.current.getAt(t.Keyword.Lexeme, dist)
+func (i *Interpreter) VisitThisExpr(t *parser.ThisExpr) (interface{}, error) {
+	if l, ok := i.locals[t]; ok {
+		return i.current.getAt(l.Depth, l.Slot), nil
 	}
 
-	return i.global.get(t.Keyword)
+	return i.module.globals.get(t.Keyword)
 }
 
-func (i *Interpreter) VisitSuperExpr(s *parser.SuperExpr) interface{} {
-	dist := i.locals[s]
-	super := i.current.getAt("super", dist).(*class)
-	object := i.current.getAt("this", dist-1).(*instance)
+func (i *Interpreter) VisitSuperExpr(s *parser.SuperExpr) (interface{}, error) {
+	l := i.locals[s]
+	super := i.current.getAt(l.Depth, l.Slot).(*class)
+	object := i.current.getAt(l.Depth-1, 0).(*instance)
 	method := super.findMethod(s.Method.Lexeme)
 	if method == nil {
 		message := fmt.Sprintf("undefined property '%s'", s.Method.Lexeme)
-		panic(fault.NewFault(s.Method.Line, message))
+		return nil, faultAt(s.Method.Span(), message)
+	}
+
+	return method.bind(object), nil
+}
+
+func (i *Interpreter) VisitListExpr(l *parser.ListExpr) (interface{}, error) {
+	elements := make([]interface{}, len(l.Elements))
+	for k, element := range l.Elements {
+		var err error
+		if elements[k], err = element.Accept(i); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := i.allocate(l.Span()); err != nil {
+		return nil, err
+	}
+
+	return &list{elements}, nil
+}
+
+func (i *Interpreter) VisitIndexExpr(e *parser.IndexExpr) (interface{}, error) {
+	object, err := e.Object.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := e.Index.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := object.(type) {
+	case *list:
+		k, err := o.index(index, len(o.elements))
+		if err != nil {
+			return nil, faultAt(e.Index.Span(), err.Error())
+		}
+
+		return o.elements[k], nil
+	case *dict:
+		value, err := o.lookup(index)
+		if err != nil {
+			return nil, faultAt(e.Index.Span(), err.Error())
+		}
+
+		return value, nil
+	}
+
+	f := faultAt(e.Close.Span(), "only lists and maps can be indexed")
+	label(f, e.Object.Span(), "this is "+article(TypeName(object)))
+	return nil, f
+}
+
+func (i *Interpreter) VisitIndexSetExpr(e *parser.IndexSetExpr) (interface{}, error) {
+	object, err := e.Object.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := e.Index.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := e.Value.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := object.(type) {
+	case *list:
+		k, err := o.index(index, len(o.elements))
+		if err != nil {
+			return nil, faultAt(e.Index.Span(), err.Error())
+		}
+
+		o.elements[k] = value
+		return value, nil
+	case *dict:
+		if err := o.set(index, value); err != nil {
+			return nil, faultAt(e.Index.Span(), err.Error())
+		}
+
+		return value, nil
+	}
+
+	f := faultAt(e.Close.Span(), "only lists and maps can be indexed")
+	label(f, e.Object.Span(), "this is "+article(TypeName(object)))
+	return nil, f
+}
+
+func (i *Interpreter) VisitMapExpr(m *parser.MapExpr) (interface{}, error) {
+	if err := i.allocate(m.Span()); err != nil {
+		return nil, err
+	}
+
+	d := newDict()
+	for k, key := range m.Keys {
+		keyValue, err := key.Accept(i)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := m.Values[k].Accept(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := d.set(keyValue, value); err != nil {
+			return nil, faultAt(key.Span(), err.Error())
+		}
 	}
 
-	return method.bind(object)
+	return d, nil
 }
 
-func (i *Interpreter) checkNumberOperands(operator *scanner.Token, left interface{}, right interface{}) (float64, float64) {
-	if leftValue, leftOk := left.(float64); leftOk {
-		if rightValue, rightOk := right.(float64); rightOk {
-			return leftValue, rightValue
+func (i *Interpreter) VisitFunctionExpr(f *parser.FunctionExpr) (interface{}, error) {
+	if err := i.allocate(f.Span()); err != nil {
+		return nil, err
+	}
+
+	return &function{"", f.Params, f.Body, i.current, false, i.module}, nil
+}
+
+// define declares a variable in the innermost scope, which is the globals of
+// the module at the top level.
+func (i *Interpreter) define(name string, value interface{}) {
+	if i.current == nil {
+		i.module.globals.define(name, value)
+	} else {
+		i.current.define(value)
+	}
+}
+
+// executeBlock runs stmts in env and stops at the first statement that does
+// not complete normally.
+func (i *Interpreter) executeBlock(stmts []parser.Stmt, env *environment) (interface{}, error) {
+	prev := i.current
+	i.current = env
+	for _, stmt := range stmts {
+		if err := i.step(stmt); err != nil {
+			i.current = prev
+			return nil, err
+		}
+
+		if c, err := stmt.Accept(i); c != nil || err != nil {
+			i.current = prev
+			return c, err
+		}
+	}
+
+	i.current = prev
+	return nil, nil
+}
+
+func (i *Interpreter) call(f callable, site scanner.Span, paren *scanner.Token, args []interface{}) (interface{}, error) {
+	if len(i.frames) >= i.limits.MaxDepth {
+		return nil, faultAt(site, "stack overflow")
+	}
+
+	i.frames = append(i.frames, frame{f, site, i.module.path})
+	value, err := f.call(i, paren, args)
+	if f, ok := err.(*fault.Fault); ok {
+		i.trace(f)
+	}
+
+	i.frames = i.frames[:len(i.frames)-1]
+	return value, err
+}
+
+// trace records the call stack on a fault while it is still intact, that is
+// when the fault leaves the innermost call.
+func (i *Interpreter) trace(f *fault.Fault) {
+	if f.Trace != nil {
+		return
+	}
+
+	if f.File == "" {
+		f.File = i.module.path
+	}
+
+	file, line, column := f.File, f.Line, f.Column
+	f.Trace = []fault.Frame{}
+	for k := len(i.frames) - 1; k >= 0; k-- {
+		f.Trace = append(f.Trace, fault.Frame{Function: frameName(i.frames[k].callee), File: file, Line: line, Column: column})
+		file, line, column = i.frames[k].file, i.frames[k].site.Line, i.frames[k].site.Column
+	}
+
+	if line > 0 {
+		f.Trace = append(f.Trace, fault.Frame{Function: "<script>", File: file, Line: line, Column: column})
+	}
+}
+
+func frameName(f interface{}) string {
+	switch c := f.(type) {
+	case *function:
+		if c.name == "" {
+			return "<anonymous>"
 		}
+		return c.name
+	case *class:
+		return c.name
+	case *native:
+		return c.fn.Name()
+	case *module:
+		return "<module " + c.name + ">"
+	}
+
+	return "<function>"
+}
+
+func faultAt(span scanner.Span, message string) *fault.Fault {
+	return fault.NewFaultAt(span.Line, span.Column, span.Start, span.End, message)
+}
+
+func label(f *fault.Fault, span scanner.Span, message string) {
+	if span.Line > 0 {
+		f.AddLabel(span.Line, span.Column, span.Start, span.End, message)
+	}
+}
+
+// labelOperands points at the operands of a failed binary operation and
+// names their types.
+func labelOperands(f *fault.Fault, b *parser.BinaryExpr, left interface{}, right interface{}) {
+	label(f, b.Left.Span(), "this is "+article(TypeName(left)))
+	label(f, b.Right.Span(), "this is "+article(TypeName(right)))
+}
+
+func article(noun string) string {
+	if noun == "nil" {
+		return noun
+	}
+
+	if strings.ContainsRune("aeiou", rune(noun[0])) {
+		return "an " + noun
 	}
 
-	panic(fault.NewFault(operator.Line, "operands must be numbers"))
+	return "a " + noun
 }
 
 func isTruthy(value interface{}) bool {
@@ -338,4 +869,33 @@ func isTruthy(value interface{}) bool {
 	}
 
 	return true
-}
\ No newline at end of file
+}
+
+// isEqual compares values with ==, except that values Go cannot compare,
+// such as a slice set from Go, are not equal to anything.
+func isEqual(a, b interface{}) bool {
+	switch a.(type) {
+	case nil, float64, string, bool:
+		return a == b
+	}
+
+	if reflect.TypeOf(a) == reflect.TypeOf(b) && !reflect.ValueOf(a).Comparable() {
+		return false
+	}
+
+	return a == b
+}
+
+// Stringify formats a Lox value the way print displays it.
+func Stringify(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
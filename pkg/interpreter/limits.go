@@ -0,0 +1,83 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+
+	"golox/pkg/fault"
+	"golox/pkg/scanner"
+)
+
+// DEFAULT_MAX_DEPTH keeps deep recursion well clear of the Go stack limit.
+const DEFAULT_MAX_DEPTH = 10000
+
+// Limits bound the resources a script may use, so that untrusted code can
+// be run safely. Apart from MaxDepth, a zero value means no limit. The limits
+// apply to each call of Interpret, Eval or Call from Go separately.
+type Limits struct {
+	// Context stops the script once it is cancelled or its deadline passes.
+	Context context.Context
+
+	// MaxSteps caps the number of statements and loop iterations executed.
+	MaxSteps int
+
+	// MaxDepth caps the number of nested calls, beyond which a call fails
+	// with a stack overflow error. Defaults to DEFAULT_MAX_DEPTH.
+	MaxDepth int
+
+	// MaxAllocations caps the number of lists, maps, instances, closures
+	// and concatenated strings that Lox code creates.
+	MaxAllocations int
+}
+
+// SetLimits replaces the limits, which by default only restrict the call
+// depth.
+func (i *Interpreter) SetLimits(l Limits) {
+	if l.MaxDepth == 0 {
+		l.MaxDepth = DEFAULT_MAX_DEPTH
+	}
+
+	i.limits = l
+}
+
+// start resets the step and allocation counts unless Lox code is already
+// running, as it is when a native calls back into Lox.
+func (i *Interpreter) start() {
+	if len(i.frames) == 0 {
+		i.steps, i.allocations = 0, 0
+	}
+}
+
+// step counts a statement or loop iteration. The context is only polled
+// every 1024 steps because checking it takes a lock.
+func (i *Interpreter) step(node interface{ Span() scanner.Span }) error {
+	i.steps++
+	if i.limits.MaxSteps > 0 && i.steps > i.limits.MaxSteps {
+		return limitAt(node.Span(), fmt.Sprintf("step limit of %d exceeded", i.limits.MaxSteps))
+	}
+
+	if i.limits.Context != nil && i.steps%1024 == 1 {
+		if err := i.limits.Context.Err(); err != nil {
+			return limitAt(node.Span(), "execution stopped: "+err.Error())
+		}
+	}
+
+	return nil
+}
+
+// allocate counts a value created at span.
+func (i *Interpreter) allocate(span scanner.Span) error {
+	i.allocations++
+	if i.limits.MaxAllocations > 0 && i.allocations > i.limits.MaxAllocations {
+		return limitAt(span, fmt.Sprintf("allocation limit of %d exceeded", i.limits.MaxAllocations))
+	}
+
+	return nil
+}
+
+// limitAt creates a fault that try statements do not catch.
+func limitAt(span scanner.Span, message string) *fault.Fault {
+	f := faultAt(span, message)
+	f.Code = fault.LIMIT_EXCEEDED
+	return f
+}
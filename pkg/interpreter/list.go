@@ -0,0 +1,167 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+
+	"golox/pkg/scanner"
+)
+
+type list struct {
+	elements []interface{}
+}
+
+// get looks up a list method. Methods are natives bound to the list.
+func (l *list) get(i *Interpreter, name *scanner.Token) (interface{}, error) {
+	var fn NativeFunction
+	switch name.Lexeme {
+	case "length":
+		fn = NewNativeFunc("length", 0, func(args []interface{}) (interface{}, error) {
+			return float64(len(l.elements)), nil
+		})
+	case "push":
+		fn = NewNativeFunc("push", 1, func(args []interface{}) (interface{}, error) {
+			l.elements = append(l.elements, args[0])
+			return nil, nil
+		})
+	case "pop":
+		fn = NewNativeFunc("pop", 0, func(args []interface{}) (interface{}, error) {
+			if len(l.elements) == 0 {
+				return nil, fmt.Errorf("cannot pop from an empty list")
+			}
+
+			last := l.elements[len(l.elements)-1]
+			l.elements = l.elements[:len(l.elements)-1]
+			return last, nil
+		})
+	case "insert":
+		fn = NewNativeFunc("insert", 2, func(args []interface{}) (interface{}, error) {
+			index, err := l.index(args[0], len(l.elements)+1)
+			if err != nil {
+				return nil, err
+			}
+
+			l.elements = append(l.elements, nil)
+			copy(l.elements[index+1:], l.elements[index:])
+			l.elements[index] = args[1]
+			return nil, nil
+		})
+	case "remove":
+		fn = NewNativeFunc("remove", 1, func(args []interface{}) (interface{}, error) {
+			index, err := l.index(args[0], len(l.elements))
+			if err != nil {
+				return nil, err
+			}
+
+			removed := l.elements[index]
+			l.elements = append(l.elements[:index], l.elements[index+1:]...)
+			return removed, nil
+		})
+	case "slice":
+		fn = NewNativeFunc("slice", -1, func(args []interface{}) (interface{}, error) {
+			if len(args) < 1 || len(args) > 2 {
+				return nil, fmt.Errorf("expected 1 or 2 arguments but got %d", len(args))
+			}
+
+			start, err := l.index(args[0], len(l.elements)+1)
+			if err != nil {
+				return nil, err
+			}
+
+			end := len(l.elements)
+			if len(args) == 2 {
+				if end, err = l.index(args[1], len(l.elements)+1); err != nil {
+					return nil, err
+				}
+			}
+
+			if end < start {
+				return nil, fmt.Errorf("slice end %d is before its start %d", end, start)
+			}
+
+			if err := i.allocate(name.Span()); err != nil {
+				return nil, err
+			}
+
+			elements := make([]interface{}, end-start)
+			copy(elements, l.elements[start:end])
+			return &list{elements}, nil
+		})
+	case "map":
+		fn = NewNativeFunc("map", 1, func(args []interface{}) (interface{}, error) {
+			if err := i.allocate(name.Span()); err != nil {
+				return nil, err
+			}
+
+			elements := make([]interface{}, len(l.elements))
+			for k, element := range l.elements {
+				value, err := i.Call(args[0], []interface{}{element})
+				if err != nil {
+					return nil, err
+				}
+				elements[k] = value
+			}
+
+			return &list{elements}, nil
+		})
+	case "filter":
+		fn = NewNativeFunc("filter", 1, func(args []interface{}) (interface{}, error) {
+			if err := i.allocate(name.Span()); err != nil {
+				return nil, err
+			}
+
+			elements := []interface{}{}
+			for _, element := range l.elements {
+				keep, err := i.Call(args[0], []interface{}{element})
+				if err != nil {
+					return nil, err
+				}
+
+				if isTruthy(keep) {
+					elements = append(elements, element)
+				}
+			}
+
+			return &list{elements}, nil
+		})
+	case "reduce":
+		fn = NewNativeFunc("reduce", 2, func(args []interface{}) (interface{}, error) {
+			acc := args[1]
+			for _, element := range l.elements {
+				var err error
+				if acc, err = i.Call(args[0], []interface{}{acc, element}); err != nil {
+					return nil, err
+				}
+			}
+
+			return acc, nil
+		})
+	default:
+		message := fmt.Sprintf("undefined property %s", name.Lexeme)
+		return nil, faultAt(name.Span(), message)
+	}
+
+	return &native{fn}, nil
+}
+
+// index checks that value is a whole number between 0 and bound, exclusive.
+func (l *list) index(value interface{}, bound int) (int, error) {
+	n, ok := value.(float64)
+	if !ok {
+		return 0, fmt.Errorf("list index must be a number but got %s", TypeName(value))
+	}
+
+	if n != math.Trunc(n) {
+		return 0, fmt.Errorf("list index must be an integer but got %s", Stringify(n))
+	}
+
+	if n < 0 || n >= float64(bound) {
+		return 0, fmt.Errorf("index %s out of bounds for list of length %d", Stringify(n), len(l.elements))
+	}
+
+	return int(n), nil
+}
+
+func (l *list) String() string {
+	return nested(l, make(map[interface{}]bool))
+}
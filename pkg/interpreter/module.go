@@ -0,0 +1,228 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golox/pkg/fault"
+	"golox/pkg/parser"
+	"golox/pkg/resolver"
+	"golox/pkg/scanner"
+)
+
+// module is a Lox file with its own global environment. Only the
+// declarations marked with export can be read by the modules importing it.
+// A module is loading while its top level code runs, so importing it again
+// during that time is a cycle.
+type module struct {
+	name    string
+	path    string
+	globals *globals
+	exports map[string]bool
+	loading bool
+}
+
+func newModule(path string, builtins *globals) *module {
+	return &module{moduleName(path), path, newGlobals(builtins), make(map[string]bool), true}
+}
+
+func (m *module) get(name *scanner.Token) (interface{}, error) {
+	if !m.exports[name.Lexeme] {
+		message := fmt.Sprintf("module %s does not export %s", m.name, name.Lexeme)
+		return nil, faultAt(name.Span(), message)
+	}
+
+	value, _ := m.globals.lookup(name.Lexeme)
+	return value, nil
+}
+
+func (m module) String() string {
+	return fmt.Sprintf("<module %s>", m.name)
+}
+
+// loader finds, reads and caches modules by their canonical path.
+type loader struct {
+	path    []string
+	read    func(path string) ([]byte, error)
+	modules map[string]*module
+}
+
+func newLoader() *loader {
+	return &loader{nil, os.ReadFile, make(map[string]*module)}
+}
+
+// SetPath sets the file name of the script being run. Relative imports are
+// looked up next to it and stack traces refer to it.
+func (i *Interpreter) SetPath(path string) {
+	i.module.path = path
+	i.module.name = moduleName(path)
+	i.module.loading = true
+	if path != "" {
+		i.loader.modules[canonical(path)] = i.module
+	}
+}
+
+// SetModulePath sets the directories that are searched for imported modules
+// not found next to the importing file.
+func (i *Interpreter) SetModulePath(dirs []string) {
+	i.loader.path = dirs
+}
+
+// SetModuleReader replaces os.ReadFile as the way module sources are read,
+// so that embedders can serve modules from memory or restrict access to the
+// file system. read must return an error wrapping fs.ErrNotExist for files
+// that do not exist.
+func (i *Interpreter) SetModuleReader(read func(path string) ([]byte, error)) {
+	i.loader.read = read
+}
+
+func (i *Interpreter) VisitImportStmt(s *parser.ImportStmt) (interface{}, error) {
+	m, err := i.load(s)
+	if err != nil {
+		return nil, err
+	}
+
+	i.define(s.Name.Lexeme, m)
+	return nil, nil
+}
+
+func (i *Interpreter) VisitExportStmt(e *parser.ExportStmt) (interface{}, error) {
+	if _, err := e.Declaration.Accept(i); err != nil {
+		return nil, err
+	}
+
+	i.module.exports[e.Exported().Lexeme] = true
+	return nil, nil
+}
+
+// load returns the module imported by s, running it first if this is the
+// first import. Compile errors in the module are returned as a fault.List.
+func (i *Interpreter) load(s *parser.ImportStmt) (*module, error) {
+	name := s.Path.Literal.(string)
+	dirs := []string{filepath.Dir(i.module.path)}
+	for _, dir := range i.loader.path {
+		if !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	if filepath.IsAbs(name) {
+		dirs = []string{""}
+	}
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		key := canonical(path)
+		if m, ok := i.loader.modules[key]; ok {
+			if m.loading {
+				return nil, faultAt(s.Path.Span(), "import cycle: "+i.cycle(m))
+			}
+			return m, nil
+		}
+
+		src, err := i.loader.read(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, faultAt(s.Path.Span(), err.Error())
+		}
+
+		m := newModule(path, i.builtins)
+		i.loader.modules[key] = m
+		if err := i.run(m, s, string(src)); err != nil {
+			// a later import runs the module again rather than seeing it half done
+			delete(i.loader.modules, key)
+			return nil, err
+		}
+
+		return m, nil
+	}
+
+	message := fmt.Sprintf("cannot find module %s", name)
+	if !filepath.IsAbs(name) {
+		message += " in " + strings.Join(dirs, ", ")
+	}
+	return nil, faultAt(s.Path.Span(), message)
+}
+
+// run executes the top level code of m. The module gets a frame of its own
+// so that runtime errors show which import triggered them.
+func (i *Interpreter) run(m *module, s *parser.ImportStmt, src string) error {
+	stmts, err := parser.ParseSource(src)
+	var res *resolver.Resolution
+	if err == nil {
+		res, err = resolver.NewResolver().Resolve(stmts)
+	}
+	if err != nil {
+		return fault.Diagnostics(err).InFile(m.path)
+	}
+
+	i.bind(res, m.globals)
+	defer i.unbind(res)
+
+	prev, env := i.module, i.current
+	i.module, i.current = m, nil
+	i.frames = append(i.frames, frame{m, s.Path.Span(), prev.path})
+	for _, stmt := range stmts {
+		if err = i.step(stmt); err == nil {
+			_, err = stmt.Accept(i)
+		}
+		if err != nil {
+			if f, ok := err.(*fault.Fault); ok {
+				i.trace(f)
+			}
+			break
+		}
+	}
+
+	i.frames = i.frames[:len(i.frames)-1]
+	i.module, i.current = prev, env
+	m.loading = false
+	return err
+}
+
+// cycle describes the chain of imports that leads back to m, which is still
+// loading.
+func (i *Interpreter) cycle(m *module) string {
+	names, found := []string{m.name}, false
+	for k := len(i.frames) - 1; k >= 0 && !found; k-- {
+		if loading, ok := i.frames[k].callee.(*module); ok {
+			names = append(names, loading.name)
+			found = loading == m
+		}
+	}
+
+	// the script itself has no frame
+	if !found {
+		names = append(names, m.name)
+	}
+
+	for l, r := 0, len(names)-1; l < r; l, r = l+1, r-1 {
+		names[l], names[r] = names[r], names[l]
+	}
+
+	return strings.Join(names, " -> ")
+}
+
+// canonical returns the absolute path of a file with symbolic links
+// resolved, so that every way of naming a module shares one cache entry.
+func canonical(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+
+	return path
+}
+
+func moduleName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
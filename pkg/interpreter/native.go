@@ -0,0 +1,390 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"golox/pkg/fault"
+	"golox/pkg/scanner"
+)
+
+// NativeFunction is a function implemented in Go and callable from Lox.
+// Arity returns -1 for functions accepting any number of arguments. An
+// error returned from Call becomes a runtime fault at the call site.
+type NativeFunction interface {
+	Name() string
+	Arity() int
+	Call(args []interface{}) (interface{}, error)
+}
+
+type native struct {
+	fn NativeFunction
+}
+
+func (n *native) arity() int { return n.fn.Arity() }
+
+// call runs the Go function. A panic in it is turned into a runtime error
+// like any other, rather than taking the host program down.
+func (n *native) call(i *Interpreter, paren *scanner.Token, args []interface{}) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, err = nil, n.fault(paren, fmt.Errorf("%s panicked: %v", n.fn.Name(), r))
+		}
+	}()
+
+	value, err = n.fn.Call(args)
+	if err != nil {
+		return nil, n.fault(paren, err)
+	}
+
+	return value, nil
+}
+
+// fault places an error from the Go function at the call site.
+func (n *native) fault(paren *scanner.Token, err error) *fault.Fault {
+	var f *fault.Fault
+	if errors.As(err, &f) {
+		return f
+	}
+
+	if paren == nil {
+		return fault.NewFault(0, err.Error())
+	}
+	return faultAt(paren.Span(), err.Error())
+}
+
+func (n native) String() string {
+	return fmt.Sprintf("<native function %s>", n.fn.Name())
+}
+
+type nativeFunc struct {
+	name  string
+	arity int
+	fn    func(args []interface{}) (interface{}, error)
+}
+
+// NewNativeFunc creates a native function that receives its arguments as
+// raw Lox values. Pass an arity of -1 for variadic functions.
+func NewNativeFunc(name string, arity int, fn func(args []interface{}) (interface{}, error)) NativeFunction {
+	return &nativeFunc{name, arity, fn}
+}
+
+func (n *nativeFunc) Name() string { return n.name }
+
+func (n *nativeFunc) Arity() int { return n.arity }
+
+func (n *nativeFunc) Call(args []interface{}) (interface{}, error) {
+	return n.fn(args)
+}
+
+var clock = NewNativeFunc("clock", 0, func(args []interface{}) (interface{}, error) {
+	return float64(time.Now().UnixMilli() / 1000), nil
+})
+
+var (
+	errorType          = reflect.TypeOf((*error)(nil)).Elem()
+	nativeFunctionType = reflect.TypeOf((*NativeFunction)(nil)).Elem()
+)
+
+type goFunc struct {
+	name string
+	fn   reflect.Value
+}
+
+// NewGoFunc adapts an arbitrary Go function to Lox, converting arguments and
+// results automatically. Parameters may be numeric types, string, bool,
+// interface{} (any Lox value), []interface{} (the elements of a list) or
+// map[string]interface{} (a map with string keys or the fields of an
+// instance), and variadic functions are supported. Slices and maps returned
+// to Lox become lists and maps. The function may return nothing, a value, an
+// error, or a value followed by an error.
+func NewGoFunc(name string, fn interface{}) (NativeFunction, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return nil, fmt.Errorf("%s: expected a function but got %T", name, fn)
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			in = in.Elem()
+		}
+
+		if !convertible(in) {
+			return nil, fmt.Errorf("%s: unsupported parameter type %s", name, in)
+		}
+	}
+
+	switch {
+	case t.NumOut() > 2:
+		return nil, fmt.Errorf("%s: too many results", name)
+	case t.NumOut() == 2 && t.Out(1) != errorType:
+		return nil, fmt.Errorf("%s: second result must be an error", name)
+	}
+
+	return &goFunc{name, v}, nil
+}
+
+func (g *goFunc) Name() string { return g.name }
+
+func (g *goFunc) Arity() int {
+	if g.fn.Type().IsVariadic() {
+		return -1
+	}
+
+	return g.fn.Type().NumIn()
+}
+
+func (g *goFunc) Call(args []interface{}) (interface{}, error) {
+	t := g.fn.Type()
+	if t.IsVariadic() && len(args) < t.NumIn()-1 {
+		return nil, fmt.Errorf("expected at least %d arguments but got %d", t.NumIn()-1, len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var param reflect.Type
+		if t.IsVariadic() && i >= t.NumIn()-1 {
+			param = t.In(t.NumIn() - 1).Elem()
+		} else {
+			param = t.In(i)
+		}
+
+		value, err := toGo(arg, param)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d to %s %s", i+1, g.name, err)
+		}
+		in[i] = value
+	}
+
+	out := g.fn.Call(in)
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return nil, err
+		}
+		out = out[:len(out)-1]
+	}
+
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	return fromGo(out[0]), nil
+}
+
+func convertible(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Interface:
+		return t.NumMethod() == 0
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.Interface && t.Elem().NumMethod() == 0
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Interface && t.Elem().NumMethod() == 0
+	}
+
+	return false
+}
+
+// toGo converts a Lox value into a Go value of type t.
+func toGo(value interface{}, t reflect.Type) (reflect.Value, error) {
+	switch t.Kind() {
+	case reflect.Interface:
+		if value == nil {
+			return reflect.Zero(t), nil
+		}
+		return reflect.ValueOf(value), nil
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			return reflect.ValueOf(b).Convert(t), nil
+		}
+	case reflect.String:
+		if s, ok := value.(string); ok {
+			return reflect.ValueOf(s).Convert(t), nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, ok := value.(float64); ok {
+			return reflect.ValueOf(n).Convert(t), nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := value.(float64); ok {
+			if n != math.Trunc(n) {
+				return reflect.Value{}, fmt.Errorf("must be an integer")
+			}
+			return reflect.ValueOf(int64(n)).Convert(t), nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := value.(float64); ok {
+			if n != math.Trunc(n) || n < 0 {
+				return reflect.Value{}, fmt.Errorf("must be a non-negative integer")
+			}
+			return reflect.ValueOf(uint64(n)).Convert(t), nil
+		}
+	case reflect.Slice:
+		if l, ok := value.(*list); ok {
+			elements := make([]interface{}, len(l.elements))
+			copy(elements, l.elements)
+			return reflect.ValueOf(elements), nil
+		}
+	case reflect.Map:
+		if inst, ok := value.(*instance); ok {
+			fields := reflect.MakeMapWithSize(t, len(inst.fields))
+			for name, field := range inst.fields {
+				if field == nil {
+					fields.SetMapIndex(reflect.ValueOf(name), reflect.Zero(t.Elem()))
+				} else {
+					fields.SetMapIndex(reflect.ValueOf(name), reflect.ValueOf(field))
+				}
+			}
+			return fields, nil
+		}
+
+		if d, ok := value.(*dict); ok {
+			entries := reflect.MakeMapWithSize(t, len(d.keys))
+			for _, key := range d.keys {
+				name, ok := key.(string)
+				if !ok {
+					return reflect.Value{}, fmt.Errorf("must have string keys but has key %s", nested(key, nil))
+				}
+
+				if d.values[key] == nil {
+					entries.SetMapIndex(reflect.ValueOf(name), reflect.Zero(t.Elem()))
+				} else {
+					entries.SetMapIndex(reflect.ValueOf(name), reflect.ValueOf(d.values[key]))
+				}
+			}
+			return entries, nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("must be %s but got %s", kindName(t), TypeName(value))
+}
+
+// ToLox converts a Go value into the equivalent Lox value, so that an int
+// becomes a float64 for example.
+func ToLox(value interface{}) interface{} {
+	return fromGo(reflect.ValueOf(value))
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// fromGo converts a Go result into a Lox value. Numbers become float64, Go
+// functions become natives and values without a Lox counterpart are passed
+// through untouched.
+func fromGo(v reflect.Value) interface{} {
+	if v.IsValid() && v.Type().Implements(nativeFunctionType) {
+		if fn, ok := v.Interface().(NativeFunction); ok && !isNil(v) {
+			return &native{fn}
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String:
+		return v.String()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			return fromGo(v.Elem())
+		}
+		if v.Kind() == reflect.Map {
+			keys := v.MapKeys()
+			sort.Slice(keys, func(i, j int) bool {
+				return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+			})
+
+			d := newDict()
+			for _, key := range keys {
+				if err := d.set(fromGo(key), fromGo(v.MapIndex(key))); err != nil {
+					return v.Interface()
+				}
+			}
+			return d
+		}
+		if v.Kind() == reflect.Func {
+			if fn, err := NewGoFunc("func", v.Interface()); err == nil {
+				return &native{fn}
+			}
+		}
+		if v.Kind() == reflect.Slice {
+			elements := make([]interface{}, v.Len())
+			for i := range elements {
+				elements[i] = fromGo(v.Index(i))
+			}
+			return &list{elements}
+		}
+	}
+
+	return v.Interface()
+}
+
+func kindName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Map:
+		return "a map or an instance"
+	case reflect.Slice:
+		return "a list"
+	}
+
+	return "a number"
+}
+
+// TypeName describes the type of a Lox value for error messages.
+func TypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *instance:
+		return "instance"
+	case *list:
+		return "list"
+	case *dict:
+		return "map"
+	case *class:
+		return "class"
+	case *module:
+		return "module"
+	case *exception:
+		return "error"
+	case callable:
+		return "function"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
@@ -2,10 +2,9 @@ package parser
 
 import "golox/pkg/scanner"
 
-
-
 type Expr interface {
-	Accept(v ExprVisitor) interface{}
+	Accept(v ExprVisitor) (interface{}, error)
+	Span() scanner.Span
 }
 
 type BinaryExpr struct {
@@ -14,104 +13,238 @@ type BinaryExpr struct {
 	Right    Expr
 }
 
-func (b *BinaryExpr) Accept(v ExprVisitor) interface{} {
+func (b *BinaryExpr) Accept(v ExprVisitor) (interface{}, error) {
 	return v.VisitBinaryExpr(b)
 }
 
+func (b *BinaryExpr) Span() scanner.Span {
+	return b.Left.Span().To(b.Right.Span())
+}
+
 type GroupingExpr struct {
+	Open       *scanner.Token
 	Expression Expr
+	Close      *scanner.Token
 }
 
-func (g *GroupingExpr) Accept(v ExprVisitor) interface{} {
+func (g *GroupingExpr) Accept(v ExprVisitor) (interface{}, error) {
 	return v.VisitGroupingExpr(g)
 }
 
+func (g *GroupingExpr) Span() scanner.Span {
+	return g.Open.Span().To(g.Close.Span())
+}
+
 type LiteralExpr struct {
+	Token *scanner.Token
 	Value interface{}
 }
 
-func (l *LiteralExpr) Accept(v ExprVisitor) interface{} {
+func (l *LiteralExpr) Accept(v ExprVisitor) (interface{}, error) {
 	return v.VisitLiteralExpr(l)
 }
 
+func (l *LiteralExpr) Span() scanner.Span {
+	if l.Token == nil {
+		return scanner.Span{}
+	}
+
+	return l.Token.Span()
+}
+
 type UnaryExpr struct {
 	Operator *scanner.Token
 	Right    Expr
 }
 
-func (u *UnaryExpr) Accept(v ExprVisitor) interface{} {
+func (u *UnaryExpr) Accept(v ExprVisitor) (interface{}, error) {
 	return v.VisitUnaryExpr(u)
 }
 
+func (u *UnaryExpr) Span() scanner.Span {
+	return u.Operator.Span().To(u.Right.Span())
+}
+
 type VariableExpr struct {
 	Name *scanner.Token
 }
 
-func (v *VariableExpr) Accept(v_ ExprVisitor) interface{} {
+func (v *VariableExpr) Accept(v_ ExprVisitor) (interface{}, error) {
 	return v_.VisitVariableExpr(v)
 }
 
+func (v *VariableExpr) Span() scanner.Span {
+	return v.Name.Span()
+}
+
 type AssignExpr struct {
 	Name  *scanner.Token
 	Value Expr
 }
 
-func (a *AssignExpr) Accept(v ExprVisitor) interface{} {
+func (a *AssignExpr) Accept(v ExprVisitor) (interface{}, error) {
 	return v.VisitAssignExpr(a)
 }
 
+func (a *AssignExpr) Span() scanner.Span {
+	return a.Name.Span().To(a.Value.Span())
+}
+
 type LogicalExpr struct {
 	Left     Expr
 	Operator *scanner.Token
 	Right    Expr
 }
 
-func (l *LogicalExpr) Accept(v ExprVisitor) interface{} {
+func (l *LogicalExpr) Accept(v ExprVisitor) (interface{}, error) {
 	return v.VisitLogicalExpr(l)
 }
 
+func (l *LogicalExpr) Span() scanner.Span {
+	return l.Left.Span().To(l.Right.Span())
+}
+
 type CallExpr struct {
 	Callee    Expr
 	Paren     scanner.Token
 	Arguments []Expr
 }
 
-func (c *CallExpr) Accept(v ExprVisitor) interface{} {
+func (c *CallExpr) Accept(v ExprVisitor) (interface{}, error) {
 	return v.VisitCallExpr(c)
 }
 
+func (c *CallExpr) Span() scanner.Span {
+	return c.Callee.Span().To(c.Paren.Span())
+}
+
 type GetExpr struct {
 	Object Expr
 	Name   *scanner.Token
 }
 
-func (g *GetExpr) Accept(v ExprVisitor) interface{} {
+func (g *GetExpr) Accept(v ExprVisitor) (interface{}, error) {
 	return v.VisitGetExpr(g)
 }
 
+func (g *GetExpr) Span() scanner.Span {
+	return g.Object.Span().To(g.Name.Span())
+}
+
 type SetExpr struct {
 	Object Expr
 	Name   *scanner.Token
 	Value  Expr
 }
 
-func (s *SetExpr) Accept(v ExprVisitor) interface{} {
+func (s *SetExpr) Accept(v ExprVisitor) (interface{}, error) {
 	return v.VisitSetExpr(s)
 }
 
+func (s *SetExpr) Span() scanner.Span {
+	return s.Object.Span().To(s.Value.Span())
+}
+
 type ThisExpr struct {
 	Keyword *scanner.Token
 }
 
-func (t *ThisExpr) Accept(v ExprVisitor) interface{} {
+func (t *ThisExpr) Accept(v ExprVisitor) (interface{}, error) {
 	return v.VisitThisExpr(t)
 }
 
+func (t *ThisExpr) Span() scanner.Span {
+	return t.Keyword.Span()
+}
+
 type SuperExpr struct {
 	Keyword *scanner.Token
 	Method  *scanner.Token
 }
 
-func (s *SuperExpr) Accept(v ExprVisitor) interface{} {
+func (s *SuperExpr) Accept(v ExprVisitor) (interface{}, error) {
 	return v.VisitSuperExpr(s)
-}
\ No newline at end of file
+}
+
+func (s *SuperExpr) Span() scanner.Span {
+	return s.Keyword.Span().To(s.Method.Span())
+}
+
+type ListExpr struct {
+	Open     *scanner.Token
+	Elements []Expr
+	Close    *scanner.Token
+}
+
+func (l *ListExpr) Accept(v ExprVisitor) (interface{}, error) {
+	return v.VisitListExpr(l)
+}
+
+func (l *ListExpr) Span() scanner.Span {
+	return l.Open.Span().To(l.Close.Span())
+}
+
+// IndexExpr is a subscript such as xs[i]. Close is the closing bracket.
+type IndexExpr struct {
+	Object Expr
+	Index  Expr
+	Close  *scanner.Token
+}
+
+func (i *IndexExpr) Accept(v ExprVisitor) (interface{}, error) {
+	return v.VisitIndexExpr(i)
+}
+
+func (i *IndexExpr) Span() scanner.Span {
+	return i.Object.Span().To(i.Close.Span())
+}
+
+type IndexSetExpr struct {
+	Object Expr
+	Index  Expr
+	Close  *scanner.Token
+	Value  Expr
+}
+
+func (i *IndexSetExpr) Accept(v ExprVisitor) (interface{}, error) {
+	return v.VisitIndexSetExpr(i)
+}
+
+func (i *IndexSetExpr) Span() scanner.Span {
+	return i.Object.Span().To(i.Value.Span())
+}
+
+// MapExpr is a map literal. Keys and Values are parallel slices.
+type MapExpr struct {
+	Open   *scanner.Token
+	Keys   []Expr
+	Values []Expr
+	Close  *scanner.Token
+}
+
+func (m *MapExpr) Accept(v ExprVisitor) (interface{}, error) {
+	return v.VisitMapExpr(m)
+}
+
+func (m *MapExpr) Span() scanner.Span {
+	return m.Open.Span().To(m.Close.Span())
+}
+
+// FunctionExpr is an anonymous function. Keyword is the fun keyword, or the
+// opening parenthesis of an arrow function such as (a) => a + 1, whose Arrow
+// is set. An arrow function with an expression body gets a synthesized Body
+// returning that expression.
+type FunctionExpr struct {
+	Keyword *scanner.Token
+	Params  []*scanner.Token
+	Arrow   *scanner.Token
+	Body    *BlockStmt
+}
+
+func (f *FunctionExpr) Accept(v ExprVisitor) (interface{}, error) {
+	return v.VisitFunctionExpr(f)
+}
+
+func (f *FunctionExpr) Span() scanner.Span {
+	return f.Keyword.Span().To(f.Body.Span())
+}
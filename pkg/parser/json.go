@@ -0,0 +1,281 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"golox/pkg/scanner"
+)
+
+// The JSON form of a syntax tree is an array of statements. Every node is an
+// object with its kind, which is the name of its Go type, and its span,
+// followed by its fields in declaration order, named as in Go with the first
+// letter lowered:
+//
+//	{"kind":"PrintStmt","span":{...},"keyword":{...},"expression":{...},...}
+//
+// Tokens are objects with their type as named by scanner.TypeName, lexeme,
+// literal if any, and location. Missing nodes, tokens and lists are null,
+// and decoding rejects null anywhere else. Spans are derived from the
+// tokens, so decoding ignores them.
+
+// nodes lists every kind of node by its name.
+var nodes = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []interface{}{
+		&BinaryExpr{}, &GroupingExpr{}, &LiteralExpr{}, &UnaryExpr{}, &VariableExpr{},
+		&AssignExpr{}, &LogicalExpr{}, &CallExpr{}, &GetExpr{}, &SetExpr{}, &ThisExpr{},
+		&SuperExpr{}, &ListExpr{}, &IndexExpr{}, &IndexSetExpr{}, &MapExpr{}, &FunctionExpr{},
+		&ExprStmt{}, &PrintStmt{}, &VarStmt{}, &BlockStmt{}, &IfStmt{}, &WhileStmt{},
+		&FunStmt{}, &ReturnStmt{}, &ClassStmt{}, &BreakStmt{}, &ContinueStmt{},
+		&ImportStmt{}, &ExportStmt{}, &ThrowStmt{}, &TryStmt{},
+	} {
+		t := reflect.TypeOf(node).Elem()
+		nodes[t.Name()] = t
+	}
+}
+
+// optional lists the fields that may be null, such as the else branch of an
+// if, the tokens left out of nodes the parser synthesizes and the parts of a
+// try that can be left out.
+var optional = map[string]bool{
+	"LiteralExpr.Token": true, "LiteralExpr.Value": true, "FunctionExpr.Arrow": true,
+	"ExprStmt.Semicolon": true, "VarStmt.Initializer": true, "BlockStmt.Open": true,
+	"BlockStmt.Close": true, "IfStmt.ElseBranch": true, "WhileStmt.Increment": true,
+	"FunStmt.Keyword": true, "ReturnStmt.Value": true, "ReturnStmt.Semicolon": true,
+	"ClassStmt.Super": true, "TryStmt.Name": true, "TryStmt.Handler": true,
+	"TryStmt.Finally": true,
+}
+
+var (
+	tokenStruct = reflect.TypeOf(scanner.Token{})
+	spanner     = reflect.TypeOf((*interface{ Span() scanner.Span })(nil)).Elem()
+)
+
+type jsonSpan struct {
+	Start  int `json:"start"`
+	End    int `json:"end"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type jsonToken struct {
+	Type    string      `json:"type"`
+	Lexeme  string      `json:"lexeme"`
+	Literal interface{} `json:"literal,omitempty"`
+	Line    int         `json:"line"`
+	Column  int         `json:"column"`
+	Start   int         `json:"start"`
+	End     int         `json:"end"`
+}
+
+// EncodeJSON returns the JSON form of stmts.
+func EncodeJSON(stmts []Stmt) ([]byte, error) {
+	b := &bytes.Buffer{}
+	if err := encode(b, reflect.ValueOf(stmts)); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// DecodeJSON rebuilds the statements encoded by EncodeJSON.
+func DecodeJSON(data []byte) ([]Stmt, error) {
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+
+	v, err := decode(tree, reflect.TypeOf([]Stmt{}))
+	if err != nil {
+		return nil, err
+	}
+
+	return v.Interface().([]Stmt), nil
+}
+
+func encode(b *bytes.Buffer, v reflect.Value) error {
+	switch {
+	case (v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer || v.Kind() == reflect.Slice) && v.IsNil():
+		b.WriteString("null")
+		return nil
+	case v.Kind() == reflect.Interface:
+		return encode(b, v.Elem())
+	case v.Type() == tokenStruct:
+		return write(b, newJSONToken(v.Addr().Interface().(*scanner.Token)))
+	case v.Kind() == reflect.Pointer && v.Elem().Type() == tokenStruct:
+		return write(b, newJSONToken(v.Interface().(*scanner.Token)))
+	case v.Kind() == reflect.Pointer && v.Type().Implements(spanner):
+		return encodeNode(b, v)
+	case v.Kind() == reflect.Slice:
+		b.WriteString("[")
+		for k := 0; k < v.Len(); k++ {
+			if k > 0 {
+				b.WriteString(",")
+			}
+			if err := encode(b, v.Index(k)); err != nil {
+				return err
+			}
+		}
+		b.WriteString("]")
+		return nil
+	case v.Kind() == reflect.Float64 || v.Kind() == reflect.String || v.Kind() == reflect.Bool:
+		return write(b, v.Interface())
+	}
+
+	return fmt.Errorf("cannot encode %s as JSON", v.Type())
+}
+
+func encodeNode(b *bytes.Buffer, v reflect.Value) error {
+	span := v.Interface().(interface{ Span() scanner.Span }).Span()
+	b.WriteString(`{"kind":`)
+	write(b, v.Elem().Type().Name())
+	b.WriteString(`,"span":`)
+	write(b, jsonSpan{span.Start, span.End, span.Line, span.Column})
+
+	node := v.Elem()
+	for k := 0; k < node.NumField(); k++ {
+		b.WriteString(",")
+		write(b, fieldName(node.Type().Field(k)))
+		b.WriteString(":")
+		if err := encode(b, node.Field(k)); err != nil {
+			return err
+		}
+	}
+
+	b.WriteString("}")
+	return nil
+}
+
+func write(b *bytes.Buffer, v interface{}) error {
+	bytes, err := json.Marshal(v)
+	b.Write(bytes)
+	return err
+}
+
+func newJSONToken(t *scanner.Token) jsonToken {
+	return jsonToken{scanner.TypeName(t.TokenType), t.Lexeme, t.Literal, t.Line, t.Column, t.Start, t.End}
+}
+
+func fieldName(f reflect.StructField) string {
+	return strings.ToLower(f.Name[:1]) + f.Name[1:]
+}
+
+// decode converts the result of unmarshalling JSON into a value of type t.
+func decode(data interface{}, t reflect.Type) (reflect.Value, error) {
+	switch {
+	case data == nil && (t.Kind() == reflect.Interface || t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice):
+		return reflect.Zero(t), nil
+	case t == tokenStruct:
+		token, err := decodeToken(data)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(*token), nil
+	case t.Kind() == reflect.Pointer && t.Elem() == tokenStruct:
+		token, err := decodeToken(data)
+		return reflect.ValueOf(token), err
+	case t.Kind() == reflect.Interface && t.NumMethod() == 0:
+		return decodeLiteral(data)
+	case t.Kind() == reflect.Interface || t.Kind() == reflect.Pointer:
+		return decodeNode(data, t)
+	case t.Kind() == reflect.Slice:
+		elements, ok := data.([]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected an array for %s", t)
+		}
+		v := reflect.MakeSlice(t, len(elements), len(elements))
+		for k, element := range elements {
+			if element == nil {
+				return reflect.Value{}, fmt.Errorf("unexpected null in %s", t)
+			}
+			e, err := decode(element, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.Index(k).Set(e)
+		}
+		return v, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot decode %s from JSON", t)
+}
+
+func decodeNode(data interface{}, t reflect.Type) (reflect.Value, error) {
+	object, ok := data.(map[string]interface{})
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("expected an object for %s", t)
+	}
+
+	kind, _ := object["kind"].(string)
+	node, ok := nodes[kind]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("unknown node kind %q", kind)
+	}
+
+	v := reflect.New(node)
+	if !v.Type().AssignableTo(t) {
+		return reflect.Value{}, fmt.Errorf("%s cannot be used as %s", kind, t)
+	}
+
+	for k := 0; k < node.NumField(); k++ {
+		field := node.Field(k)
+		data := object[fieldName(field)]
+		if data == nil && field.Type.Kind() != reflect.Slice && !optional[kind+"."+field.Name] {
+			return reflect.Value{}, fmt.Errorf("%s.%s is missing", kind, field.Name)
+		}
+
+		value, err := decode(data, field.Type)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%s.%s: %w", kind, field.Name, err)
+		}
+		v.Elem().Field(k).Set(value)
+	}
+
+	return v, nil
+}
+
+func decodeToken(data interface{}) (*scanner.Token, error) {
+	// going through JSON again is the simplest way to fill in a struct
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var t jsonToken
+	if err := json.Unmarshal(bytes, &t); err != nil {
+		return nil, err
+	}
+
+	tokenType, ok := scanner.TypeOf(t.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown token type %q", t.Type)
+	}
+
+	return &scanner.Token{
+		TokenType: tokenType,
+		Lexeme:    t.Lexeme,
+		Literal:   t.Literal,
+		Line:      t.Line,
+		Column:    t.Column,
+		Start:     t.Start,
+		End:       t.End,
+	}, nil
+}
+
+// decodeLiteral returns the value of a literal, which JSON can represent as
+// it is.
+func decodeLiteral(data interface{}) (reflect.Value, error) {
+	switch data.(type) {
+	case nil:
+		return reflect.Zero(reflect.TypeOf((*interface{})(nil)).Elem()), nil
+	case float64, string, bool:
+		return reflect.ValueOf(data), nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("unexpected literal %v", data)
+}
@@ -0,0 +1,141 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+func parseFile(t *testing.T, path string) []Stmt {
+	t.Helper()
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stmts, err := ParseSource(string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stmts
+}
+
+// TestJSONRoundTrip checks that decoding the JSON form of a program that
+// uses every kind of node gives back the same tree.
+func TestJSONRoundTrip(t *testing.T) {
+	stmts := parseFile(t, filepath.Join("testdata", "all.lox"))
+	data, err := EncodeJSON(stmts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, stmts) {
+		t.Error("the decoded tree differs from the parsed one")
+	}
+
+	again, err := EncodeJSON(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Error("encoding the decoded tree gave different JSON")
+	}
+
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	kinds(tree, seen)
+	missing := []string{}
+	for kind := range nodes {
+		if !seen[kind] {
+			missing = append(missing, kind)
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		t.Errorf("testdata/all.lox has no %v", missing)
+	}
+}
+
+// kinds collects the kinds of the nodes in a decoded JSON tree.
+func kinds(tree interface{}, seen map[string]bool) {
+	switch v := tree.(type) {
+	case []interface{}:
+		for _, element := range v {
+			kinds(element, seen)
+		}
+	case map[string]interface{}:
+		if kind, ok := v["kind"].(string); ok {
+			seen[kind] = true
+		}
+		for _, field := range v {
+			kinds(field, seen)
+		}
+	}
+}
+
+// TestJSONGolden compares the JSON form of a for loop, as golox ast -json
+// prints it, with testdata/for.json.
+func TestJSONGolden(t *testing.T) {
+	stmts := parseFile(t, filepath.Join("testdata", "for.lox"))
+	data, err := EncodeJSON(stmts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := json.Indent(&b, data, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	b.WriteString("\n")
+
+	golden := filepath.Join("testdata", "for.json")
+	if *update {
+		if err := os.WriteFile(golden, b.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("JSON differs from %s:\n%s", golden, b.String())
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	for _, data := range []string{
+		`{}`,
+		`[{"kind":"NoSuchStmt"}]`,
+		`[{"kind":"BinaryExpr"}]`,
+		`[{"kind":"PrintStmt","keyword":{"type":"NO_SUCH_TOKEN"}}]`,
+		`[null]`,
+		`[{"kind":"PrintStmt"}]`,
+		`[{"kind":"VarStmt"}]`,
+		`[{"kind":"ExprStmt","expression":{"kind":"BinaryExpr"}}]`,
+		`[{"kind":"ExprStmt","expression":{"kind":"CallExpr","callee":{"kind":"ThisExpr","keyword":{"type":"THIS"}}}}]`,
+		`[{"kind":"BlockStmt","statements":[null]}]`,
+	} {
+		if _, err := DecodeJSON([]byte(data)); err == nil {
+			t.Errorf("DecodeJSON(%s) succeeded", data)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"sort"
 
 	"golox/pkg/fault"
 	"golox/pkg/scanner"
@@ -10,7 +11,7 @@ import (
 type Parser struct {
 	tokens  []scanner.Token
 	current int
-	err     error
+	diags   fault.List
 }
 
 func NewParser(tokens []scanner.Token) *Parser {
@@ -23,7 +24,24 @@ func (p *Parser) Parse() ([]Stmt, error) {
 		stmts = append(stmts, p.declaration())
 	}
 
-	return stmts, p.err
+	return stmts, p.diags.Err()
+}
+
+// ParseSource scans and parses src. Problems found by the scanner do not
+// stop the parser, so the error lists everything wrong with src, in source
+// order.
+func ParseSource(src string) ([]Stmt, error) {
+	s := scanner.NewScanner(src)
+	scanErr := s.ScanTokens()
+	stmts, parseErr := NewParser(s.Tokens).Parse()
+
+	diags := append(fault.Diagnostics(scanErr), fault.Diagnostics(parseErr)...)
+	if err := diags.Err(); err != nil {
+		sort.SliceStable(diags, func(i, j int) bool { return diags[i].Span.Start < diags[j].Span.Start })
+		return nil, err
+	}
+
+	return stmts, nil
 }
 
 func (p *Parser) declaration() Stmt {
@@ -33,7 +51,9 @@ func (p *Parser) declaration() Stmt {
 		return p.varDeclaration()
 	}
 
-	if p.match(scanner.FUN) {
+	// fun without a name starts an anonymous function expression
+	if p.tokens[p.current].TokenType == scanner.FUN && p.tokens[p.current+1].TokenType == scanner.IDENTIFIER {
+		p.current++
 		return p.funDeclaration("function")
 	}
 
@@ -41,12 +61,61 @@ func (p *Parser) declaration() Stmt {
 		return p.classDeclaration()
 	}
 
+	if p.match(scanner.IMPORT) {
+		return p.importDeclaration()
+	}
+
+	if p.match(scanner.EXPORT) {
+		return p.exportDeclaration()
+	}
+
 	return p.statement()
 }
 
+// importDeclaration parses import "path" as name;. The word as is not
+// reserved, so it is matched as an identifier.
+func (p *Parser) importDeclaration() *ImportStmt {
+	keyword := &p.tokens[p.current-1]
+	if !p.match(scanner.STRING) {
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected module path after 'import'"))
+	}
+	path := &p.tokens[p.current-1]
+
+	if p.tokens[p.current].TokenType != scanner.IDENTIFIER || p.tokens[p.current].Lexeme != "as" {
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected 'as' after module path"))
+	}
+	p.current++
+
+	if !p.match(scanner.IDENTIFIER) {
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected module name after 'as'"))
+	}
+	name := &p.tokens[p.current-1]
+
+	if !p.match(scanner.SEMICOLON) {
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ';' after import"))
+	}
+
+	return &ImportStmt{keyword, path, name, &p.tokens[p.current-1]}
+}
+
+func (p *Parser) exportDeclaration() *ExportStmt {
+	keyword := &p.tokens[p.current-1]
+	switch {
+	case p.match(scanner.VAR):
+		return &ExportStmt{keyword, p.varDeclaration()}
+	case p.match(scanner.CLASS):
+		return &ExportStmt{keyword, p.classDeclaration()}
+	case p.match(scanner.FUN):
+		return &ExportStmt{keyword, p.funDeclaration("function")}
+	}
+
+	panic(p.error(fault.UNEXPECTED_TOKEN, "expected variable, function or class declaration after 'export'"))
+}
+
 func (p *Parser) varDeclaration() *VarStmt {
+	keyword := &p.tokens[p.current-1]
 	if !p.match(scanner.IDENTIFIER) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected variable name"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected variable name"))
 	}
 
 	name := p.tokens[p.current-1]
@@ -56,72 +125,85 @@ func (p *Parser) varDeclaration() *VarStmt {
 	}
 
 	if !p.match(scanner.SEMICOLON) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected ';' after variable declaration"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ';' after variable declaration"))
 	}
 
-	return &VarStmt{&name, initializer}
+	return &VarStmt{keyword, &name, initializer, &p.tokens[p.current-1]}
 }
 
 func (p *Parser) funDeclaration(kind string) *FunStmt {
+	var keyword *scanner.Token
+	if p.tokens[p.current-1].TokenType == scanner.FUN {
+		keyword = &p.tokens[p.current-1]
+	}
+
 	if !p.match(scanner.IDENTIFIER) {
 		message := fmt.Sprintf("expected %s name", kind)
-		panic(fault.NewFault(p.tokens[p.current].Line, message))
+		panic(p.error(fault.UNEXPECTED_TOKEN, message))
 	}
 	name := p.tokens[p.current-1]
 
 	if !p.match(scanner.LEFT_PAREN) {
 		message := fmt.Sprintf("expected '(' after %s name", kind)
-		panic(fault.NewFault(p.tokens[p.current].Line, message))
+		panic(p.error(fault.UNEXPECTED_TOKEN, message))
 	}
+	params := p.parameters()
 
+	if !p.match(scanner.LEFT_BRACE) {
+		message := fmt.Sprintf("expected '{' before %s body", kind)
+		panic(p.error(fault.UNEXPECTED_TOKEN, message))
+	}
+
+	return &FunStmt{keyword, &name, params, p.blockStatement()}
+}
+
+// parameters parses a parameter list up to and including the closing
+// parenthesis.
+func (p *Parser) parameters() []*scanner.Token {
 	params := []*scanner.Token{}
 	if p.tokens[p.current].TokenType != scanner.RIGHT_PAREN && p.tokens[p.current].TokenType != scanner.EOF {
 		if !p.match(scanner.IDENTIFIER) {
 			message := fmt.Sprintf("expected parameter name at %s", p.tokens[p.current].Lexeme)
-			panic(fault.NewFault(p.tokens[p.current].Line, message))
+			panic(p.error(fault.UNEXPECTED_TOKEN, message))
 		}
 		params = append(params, &p.tokens[p.current-1])
 		for p.match(scanner.COMMA) {
 			if !p.match(scanner.IDENTIFIER) {
 				message := fmt.Sprintf("expected parameter name at %s", p.tokens[p.current].Lexeme)
-				panic(fault.NewFault(p.tokens[p.current].Line, message))
+				panic(p.error(fault.UNEXPECTED_TOKEN, message))
 			}
 			params = append(params, &p.tokens[p.current-1])
 			if len(params) > 255 {
-				panic(fault.NewFault(p.tokens[p.current].Line, "cannot have more than 255 parameters"))
+				panic(p.error(fault.TOO_MANY_ITEMS, "cannot have more than 255 parameters"))
 			}
 		}
 	}
 
 	if !p.match(scanner.RIGHT_PAREN) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected ')' after parameter list"))
-	}
-
-	if !p.match(scanner.LEFT_BRACE) {
-		message := fmt.Sprintf("expected '{' before %s body", kind)
-		panic(fault.NewFault(p.tokens[p.current].Line, message))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ')' after parameter list"))
 	}
 
-	return &FunStmt{&name, params, p.blockStatement()}
+	return params
 }
 
 func (p *Parser) classDeclaration() *ClassStmt {
+	keyword := &p.tokens[p.current-1]
 	if !p.match(scanner.IDENTIFIER) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected class name"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected class name"))
 	}
 	name := p.tokens[p.current-1]
 
 	var super *VariableExpr
 	if p.match(scanner.LESS) {
 		if !p.match(scanner.IDENTIFIER) {
-			panic(fault.NewFault(p.tokens[p.current].Line, "expected superclass name after '<'"))
+			panic(p.error(fault.UNEXPECTED_TOKEN, "expected superclass name after '<'"))
 		}
 		superName := p.tokens[p.current-1]
 		super = &VariableExpr{&superName}
 	}
 
 	if !p.match(scanner.LEFT_BRACE) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected '{' before class body"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected '{' before class body"))
 	}
 
 	methods := []*FunStmt{}
@@ -130,10 +212,10 @@ func (p *Parser) classDeclaration() *ClassStmt {
 	}
 
 	if !p.match(scanner.RIGHT_BRACE) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected '}' after class body"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected '}' after class body"))
 	}
 
-	return &ClassStmt{&name, super, methods}
+	return &ClassStmt{keyword, &name, super, methods, &p.tokens[p.current-1]}
 }
 
 func (p *Parser) statement() Stmt {
@@ -153,7 +235,8 @@ func (p *Parser) statement() Stmt {
 		return p.whileStatement()
 	}
 
-	if p.match(scanner.LEFT_BRACE) {
+	if p.tokens[p.current].TokenType == scanner.LEFT_BRACE && !p.mapAhead() {
+		p.current++
 		return p.blockStatement()
 	}
 
@@ -161,26 +244,95 @@ func (p *Parser) statement() Stmt {
 		return p.returnStatement()
 	}
 
+	if p.match(scanner.BREAK) {
+		return p.breakStatement()
+	}
+
+	if p.match(scanner.CONTINUE) {
+		return p.continueStatement()
+	}
+
+	if p.match(scanner.THROW) {
+		return p.throwStatement()
+	}
+
+	if p.match(scanner.TRY) {
+		return p.tryStatement()
+	}
+
 	return p.exprStatement()
 }
 
+func (p *Parser) throwStatement() *ThrowStmt {
+	keyword := &p.tokens[p.current-1]
+	value := p.expression()
+	if !p.match(scanner.SEMICOLON) {
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ';' after thrown value"))
+	}
+
+	return &ThrowStmt{keyword, value, &p.tokens[p.current-1]}
+}
+
+func (p *Parser) tryStatement() *TryStmt {
+	keyword := &p.tokens[p.current-1]
+	if !p.match(scanner.LEFT_BRACE) {
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected '{' after 'try'"))
+	}
+	body := p.blockStatement()
+
+	var name *scanner.Token
+	var handler *BlockStmt
+	if p.match(scanner.CATCH) {
+		if !p.match(scanner.LEFT_PAREN) {
+			panic(p.error(fault.UNEXPECTED_TOKEN, "expected '(' after 'catch'"))
+		}
+		if !p.match(scanner.IDENTIFIER) {
+			panic(p.error(fault.UNEXPECTED_TOKEN, "expected error variable name"))
+		}
+		name = &p.tokens[p.current-1]
+		if !p.match(scanner.RIGHT_PAREN) {
+			panic(p.error(fault.UNEXPECTED_TOKEN, "expected ')' after error variable"))
+		}
+		if !p.match(scanner.LEFT_BRACE) {
+			panic(p.error(fault.UNEXPECTED_TOKEN, "expected '{' before catch body"))
+		}
+		handler = p.blockStatement()
+	}
+
+	var finally *BlockStmt
+	if p.match(scanner.FINALLY) {
+		if !p.match(scanner.LEFT_BRACE) {
+			panic(p.error(fault.UNEXPECTED_TOKEN, "expected '{' after 'finally'"))
+		}
+		finally = p.blockStatement()
+	}
+
+	if handler == nil && finally == nil {
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected 'catch' or 'finally' after try block"))
+	}
+
+	return &TryStmt{keyword, body, name, handler, finally}
+}
+
 func (p *Parser) printStatement() *PrintStmt {
+	keyword := &p.tokens[p.current-1]
 	expr := p.expression()
 	if !p.match(scanner.SEMICOLON) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected ';' after print statement"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ';' after print statement"))
 	}
 
-	return &PrintStmt{expr}
+	return &PrintStmt{keyword, expr, &p.tokens[p.current-1]}
 }
 
 func (p *Parser) ifStatement() *IfStmt {
+	keyword := &p.tokens[p.current-1]
 	if !p.match(scanner.LEFT_PAREN) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected '(' after if"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected '(' after if"))
 	}
 
 	condition := p.expression()
 	if !p.match(scanner.RIGHT_PAREN) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected ')' after conditional expression"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ')' after conditional expression"))
 	}
 
 	thenBranch := p.statement()
@@ -189,12 +341,13 @@ func (p *Parser) ifStatement() *IfStmt {
 		elseBranch = p.statement()
 	}
 
-	return &IfStmt{condition, thenBranch, elseBranch}
+	return &IfStmt{keyword, condition, thenBranch, elseBranch}
 }
 
 func (p *Parser) forStatement() Stmt {
+	keyword := &p.tokens[p.current-1]
 	if !p.match(scanner.LEFT_PAREN) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected '(' after for"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected '(' after for"))
 	}
 
 	var initializer Stmt
@@ -211,7 +364,7 @@ func (p *Parser) forStatement() Stmt {
 		condition = p.expression()
 	}
 	if !p.match(scanner.SEMICOLON) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected ';' after conditional expression"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ';' after conditional expression"))
 	}
 
 	var increment Expr
@@ -219,60 +372,57 @@ func (p *Parser) forStatement() Stmt {
 		increment = p.expression()
 	}
 	if !p.match(scanner.RIGHT_PAREN) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected ')' after for clause"))
-	}
-
-	body := p.statement()
-	if increment != nil {
-		body = &BlockStmt{[]Stmt{body, &ExprStmt{increment}}}
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ')' after for clause"))
 	}
 
 	if condition == nil {
-		condition = &LiteralExpr{true}
+		condition = &LiteralExpr{nil, true}
 	}
 
-	body = &WhileStmt{condition, body}
+	var body Stmt = &WhileStmt{keyword, condition, p.statement(), increment}
 
 	if initializer != nil {
-		body = &BlockStmt{[]Stmt{initializer, body}}
+		body = &BlockStmt{nil, []Stmt{initializer, body}, nil}
 	}
 
 	return body
 }
 
 func (p *Parser) whileStatement() *WhileStmt {
+	keyword := &p.tokens[p.current-1]
 	if !p.match(scanner.LEFT_PAREN) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected '(' after while"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected '(' after while"))
 	}
 
 	condition := p.expression()
 	if !p.match(scanner.RIGHT_PAREN) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected ')' after conditional expression"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ')' after conditional expression"))
 	}
 
-	return &WhileStmt{condition, p.statement()}
+	return &WhileStmt{keyword, condition, p.statement(), nil}
 }
 
 func (p *Parser) blockStatement() *BlockStmt {
+	open := &p.tokens[p.current-1]
 	stmts := []Stmt{}
 	for p.tokens[p.current].TokenType != scanner.RIGHT_BRACE && p.tokens[p.current].TokenType != scanner.EOF {
 		stmts = append(stmts, p.declaration())
 	}
 
 	if !p.match(scanner.RIGHT_BRACE) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected '}' after block"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected '}' after block"))
 	}
 
-	return &BlockStmt{stmts}
+	return &BlockStmt{open, stmts, &p.tokens[p.current-1]}
 }
 
 func (p *Parser) exprStatement() *ExprStmt {
 	expr := p.expression()
 	if !p.match(scanner.SEMICOLON) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected ';' after expression statement"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ';' after expression statement"))
 	}
 
-	return &ExprStmt{expr}
+	return &ExprStmt{expr, &p.tokens[p.current-1]}
 }
 
 func (p *Parser) returnStatement() *ReturnStmt {
@@ -283,10 +433,28 @@ func (p *Parser) returnStatement() *ReturnStmt {
 	}
 
 	if !p.match(scanner.SEMICOLON) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected ';' after return statement"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ';' after return statement"))
+	}
+
+	return &ReturnStmt{&keyword, value, &p.tokens[p.current-1]}
+}
+
+func (p *Parser) breakStatement() *BreakStmt {
+	keyword := &p.tokens[p.current-1]
+	if !p.match(scanner.SEMICOLON) {
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ';' after break"))
+	}
+
+	return &BreakStmt{keyword, &p.tokens[p.current-1]}
+}
+
+func (p *Parser) continueStatement() *ContinueStmt {
+	keyword := &p.tokens[p.current-1]
+	if !p.match(scanner.SEMICOLON) {
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ';' after continue"))
 	}
 
-	return &ReturnStmt{&keyword, value}
+	return &ContinueStmt{keyword, &p.tokens[p.current-1]}
 }
 
 func (p *Parser) expression() Expr {
@@ -296,7 +464,6 @@ func (p *Parser) expression() Expr {
 func (p *Parser) assignment() Expr {
 	expr := p.or()
 	if p.match(scanner.EQUAL) {
-		equals := p.tokens[p.current-1]
 		value := p.assignment()
 
 		if variable, ok := expr.(*VariableExpr); ok {
@@ -307,7 +474,13 @@ func (p *Parser) assignment() Expr {
 			return &SetExpr{get.Object, get.Name, value}
 		}
 
-		fault.NewFault(equals.Line, "invalid assignment target")
+		if index, ok := expr.(*IndexExpr); ok {
+			return &IndexSetExpr{index.Object, index.Index, index.Close, value}
+		}
+
+		span := expr.Span()
+		message := "invalid assignment target"
+		p.diags = append(p.diags, fault.NewDiagnosticAt(fault.INVALID_ASSIGNMENT, span.Line, span.Column, span.Start, span.End, message))
 	}
 
 	return expr
@@ -397,10 +570,16 @@ func (p *Parser) call() Expr {
 			expr = &CallExpr{expr, paren, args}
 		} else if p.match(scanner.DOT) {
 			if !p.match(scanner.IDENTIFIER) {
-				panic(fault.NewFault(p.tokens[p.current].Line, "expected property name after '.'"))
+				panic(p.error(fault.UNEXPECTED_TOKEN, "expected property name after '.'"))
 			}
 			name := p.tokens[p.current-1]
 			expr = &GetExpr{expr, &name}
+		} else if p.match(scanner.LEFT_BRACKET) {
+			index := p.expression()
+			if !p.match(scanner.RIGHT_BRACKET) {
+				panic(p.error(fault.UNEXPECTED_TOKEN, "expected ']' after index"))
+			}
+			expr = &IndexExpr{expr, index, &p.tokens[p.current-1]}
 		} else {
 			break
 		}
@@ -416,13 +595,13 @@ func (p *Parser) arguments() ([]Expr, scanner.Token) {
 		for p.match(scanner.COMMA) {
 			args = append(args, p.expression())
 			if len(args) > 255 {
-				panic(fault.NewFault(p.tokens[p.current].Line, "cannot have more than 255 arguments"))
+				panic(p.error(fault.TOO_MANY_ITEMS, "cannot have more than 255 arguments"))
 			}
 		}
 	}
 
 	if !p.match(scanner.RIGHT_PAREN) {
-		panic(fault.NewFault(p.tokens[p.current].Line, "expected ')' after argument list"))
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ')' after argument list"))
 	}
 
 	return args, p.tokens[p.current-1]
@@ -430,20 +609,20 @@ func (p *Parser) arguments() ([]Expr, scanner.Token) {
 
 func (p *Parser) primary() Expr {
 	if p.match(scanner.FALSE) {
-		return &LiteralExpr{false}
+		return &LiteralExpr{&p.tokens[p.current-1], false}
 	}
 
 	if p.match(scanner.TRUE) {
-		return &LiteralExpr{true}
+		return &LiteralExpr{&p.tokens[p.current-1], true}
 	}
 
 	if p.match(scanner.NIL) {
-		return &LiteralExpr{nil}
+		return &LiteralExpr{&p.tokens[p.current-1], nil}
 	}
 
 	if p.match(scanner.NUMBER, scanner.STRING) {
 		value := p.tokens[p.current-1].Literal
-		return &LiteralExpr{value}
+		return &LiteralExpr{&p.tokens[p.current-1], value}
 	}
 
 	if p.match(scanner.IDENTIFIER) {
@@ -459,23 +638,139 @@ func (p *Parser) primary() Expr {
 	if p.match(scanner.SUPER) {
 		keyword := p.tokens[p.current-1]
 		if !p.match(scanner.DOT) || !p.match(scanner.IDENTIFIER) {
-			panic(fault.NewFault(p.tokens[p.current].Line, "expected property access after 'super'"))
+			panic(p.error(fault.UNEXPECTED_TOKEN, "expected property access after 'super'"))
 		}
 		method := p.tokens[p.current-1]
 		return &SuperExpr{&keyword, &method}
 	}
 
+	if p.match(scanner.FUN) {
+		keyword := &p.tokens[p.current-1]
+		if !p.match(scanner.LEFT_PAREN) {
+			panic(p.error(fault.UNEXPECTED_TOKEN, "expected '(' after fun"))
+		}
+		params := p.parameters()
+
+		if !p.match(scanner.LEFT_BRACE) {
+			panic(p.error(fault.UNEXPECTED_TOKEN, "expected '{' before function body"))
+		}
+
+		return &FunctionExpr{keyword, params, nil, p.blockStatement()}
+	}
+
+	if p.tokens[p.current].TokenType == scanner.LEFT_PAREN && p.arrowAhead() {
+		return p.arrowFunction()
+	}
+
 	if p.match(scanner.LEFT_PAREN) {
+		open := &p.tokens[p.current-1]
 		e := p.expression()
 		if !p.match(scanner.RIGHT_PAREN) {
 			message := fmt.Sprintf("expected ')' after '%s'", p.tokens[p.current-1].Lexeme)
-			panic(fault.NewFault(p.tokens[p.current].Line, message))
+			panic(p.error(fault.UNEXPECTED_TOKEN, message))
 		}
-		return &GroupingExpr{e}
+		return &GroupingExpr{open, e, &p.tokens[p.current-1]}
+	}
+
+	if p.match(scanner.LEFT_BRACKET) {
+		return p.list()
+	}
+
+	if p.match(scanner.LEFT_BRACE) {
+		return p.dict()
 	}
 
 	message := fmt.Sprintf("expected expression at '%s'", p.tokens[p.current].Lexeme)
-	panic(fault.NewFault(p.tokens[p.current].Line, message))
+	panic(p.error(fault.UNEXPECTED_TOKEN, message))
+}
+
+func (p *Parser) list() *ListExpr {
+	open := &p.tokens[p.current-1]
+	elements := []Expr{}
+	if p.tokens[p.current].TokenType != scanner.RIGHT_BRACKET && p.tokens[p.current].TokenType != scanner.EOF {
+		elements = append(elements, p.expression())
+		for p.match(scanner.COMMA) {
+			if p.tokens[p.current].TokenType == scanner.RIGHT_BRACKET {
+				break
+			}
+			elements = append(elements, p.expression())
+		}
+	}
+
+	if !p.match(scanner.RIGHT_BRACKET) {
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected ']' after list elements"))
+	}
+
+	return &ListExpr{open, elements, &p.tokens[p.current-1]}
+}
+
+func (p *Parser) arrowFunction() *FunctionExpr {
+	p.current++
+	open := &p.tokens[p.current-1]
+	params := p.parameters()
+	p.current++
+	arrow := &p.tokens[p.current-1]
+
+	if p.tokens[p.current].TokenType == scanner.LEFT_BRACE && !p.mapAhead() {
+		p.current++
+		return &FunctionExpr{open, params, arrow, p.blockStatement()}
+	}
+
+	body := &ReturnStmt{arrow, p.expression(), nil}
+	return &FunctionExpr{open, params, arrow, &BlockStmt{nil, []Stmt{body}, nil}}
+}
+
+// arrowAhead reports whether the parenthesis at the current token opens the
+// parameter list of an arrow function rather than a grouping.
+func (p *Parser) arrowAhead() bool {
+	k := p.current + 1
+	if p.tokens[k].TokenType == scanner.IDENTIFIER {
+		k++
+		for p.tokens[k].TokenType == scanner.COMMA && p.tokens[k+1].TokenType == scanner.IDENTIFIER {
+			k += 2
+		}
+	}
+
+	return p.tokens[k].TokenType == scanner.RIGHT_PAREN && p.tokens[k+1].TokenType == scanner.ARROW
+}
+
+func (p *Parser) dict() *MapExpr {
+	open := &p.tokens[p.current-1]
+	keys, values := []Expr{}, []Expr{}
+	for p.tokens[p.current].TokenType != scanner.RIGHT_BRACE && p.tokens[p.current].TokenType != scanner.EOF {
+		keys = append(keys, p.expression())
+		if !p.match(scanner.COLON) {
+			panic(p.error(fault.UNEXPECTED_TOKEN, "expected ':' after map key"))
+		}
+		values = append(values, p.expression())
+
+		if !p.match(scanner.COMMA) {
+			break
+		}
+	}
+
+	if !p.match(scanner.RIGHT_BRACE) {
+		panic(p.error(fault.UNEXPECTED_TOKEN, "expected '}' after map entries"))
+	}
+
+	return &MapExpr{open, keys, values, &p.tokens[p.current-1]}
+}
+
+// mapAhead reports whether the brace at the current token opens a map
+// literal rather than a block, which is the case when it is followed by a
+// single token key and a colon. A statement starting with {} is an empty
+// block.
+func (p *Parser) mapAhead() bool {
+	if p.current+2 >= len(p.tokens) {
+		return false
+	}
+
+	switch p.tokens[p.current+1].TokenType {
+	case scanner.STRING, scanner.NUMBER, scanner.IDENTIFIER, scanner.TRUE, scanner.FALSE, scanner.NIL:
+		return p.tokens[p.current+2].TokenType == scanner.COLON
+	}
+
+	return false
 }
 
 func (p *Parser) match(types ...int) bool {
@@ -496,7 +791,15 @@ func (p *Parser) match(types ...int) bool {
 
 func (p *Parser) synchronize() {
 	if r := recover(); r != nil {
-		defer func() { p.err = r.(error) }()
+		d, ok := r.(*fault.Diagnostic)
+		if !ok {
+			panic(r)
+		}
+
+		// the scanner has already reported error tokens
+		if p.tokens[p.current].TokenType != scanner.ERROR {
+			defer func() { p.diags = append(p.diags, d) }()
+		}
 
 		if p.tokens[p.current].TokenType != scanner.EOF {
 			p.current++
@@ -524,9 +827,22 @@ func (p *Parser) synchronize() {
 				return
 			case scanner.RETURN:
 				return
+			case scanner.IMPORT:
+				return
+			case scanner.EXPORT:
+				return
+			case scanner.THROW:
+				return
+			case scanner.TRY:
+				return
 			}
 
 			p.current++
 		}
 	}
-}
\ No newline at end of file
+}
+
+func (p *Parser) error(code string, message string) *fault.Diagnostic {
+	token := &p.tokens[p.current]
+	return fault.NewDiagnosticAt(code, token.Line, token.Column, token.Start, token.End, message)
+}
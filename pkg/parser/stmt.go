@@ -2,88 +2,281 @@ package parser
 
 import "golox/pkg/scanner"
 
-
 type Stmt interface {
-	Accept(v StmtVisitor) interface{}
+	Accept(v StmtVisitor) (interface{}, error)
+	Span() scanner.Span
 }
 
 type ExprStmt struct {
 	Expression Expr
+	Semicolon  *scanner.Token
 }
 
-func (e *ExprStmt) Accept(v StmtVisitor) interface{} {
+func (e *ExprStmt) Accept(v StmtVisitor) (interface{}, error) {
 	return v.VisitExprStmt(e)
 }
 
+func (e *ExprStmt) Span() scanner.Span {
+	return e.Expression.Span().To(tokenSpan(e.Semicolon))
+}
+
 type PrintStmt struct {
+	Keyword    *scanner.Token
 	Expression Expr
+	Semicolon  *scanner.Token
 }
 
-func (p *PrintStmt) Accept(v StmtVisitor) interface{} {
+func (p *PrintStmt) Accept(v StmtVisitor) (interface{}, error) {
 	return v.VisitPrintStmt(p)
 }
 
+func (p *PrintStmt) Span() scanner.Span {
+	return p.Keyword.Span().To(p.Semicolon.Span())
+}
+
 type VarStmt struct {
+	Keyword     *scanner.Token
 	Name        *scanner.Token
 	Initializer Expr
+	Semicolon   *scanner.Token
 }
 
-func (v *VarStmt) Accept(v_ StmtVisitor) interface{} {
+func (v *VarStmt) Accept(v_ StmtVisitor) (interface{}, error) {
 	return v_.VisitVarStmt(v)
 }
 
+func (v *VarStmt) Span() scanner.Span {
+	return v.Keyword.Span().To(v.Semicolon.Span())
+}
+
 type BlockStmt struct {
+	Open       *scanner.Token
 	Statements []Stmt
+	Close      *scanner.Token
 }
 
-func (b *BlockStmt) Accept(v StmtVisitor) interface{} {
+func (b *BlockStmt) Accept(v StmtVisitor) (interface{}, error) {
 	return v.VisitBlockStmt(b)
 }
 
+// Span covers the braces, or the statements for blocks the parser
+// synthesizes while desugaring for loops.
+func (b *BlockStmt) Span() scanner.Span {
+	if b.Open != nil {
+		return b.Open.Span().To(tokenSpan(b.Close))
+	}
+
+	span := scanner.Span{}
+	for _, stmt := range b.Statements {
+		span = span.To(stmt.Span())
+	}
+
+	return span
+}
+
 type IfStmt struct {
+	Keyword    *scanner.Token
 	Condition  Expr
 	ThenBranch Stmt
 	ElseBranch Stmt
 }
 
-func (i *IfStmt) Accept(v StmtVisitor) interface{} {
+func (i *IfStmt) Accept(v StmtVisitor) (interface{}, error) {
 	return v.VisitIfStmt(i)
 }
 
+func (i *IfStmt) Span() scanner.Span {
+	if i.ElseBranch != nil {
+		return i.Keyword.Span().To(i.ElseBranch.Span())
+	}
+
+	return i.Keyword.Span().To(i.ThenBranch.Span())
+}
+
+// WhileStmt is a while loop or a desugared for loop, in which case Increment
+// holds the for loop's increment clause, if any. It runs after every
+// iteration, including those ended by continue.
 type WhileStmt struct {
+	Keyword   *scanner.Token
 	Condition Expr
 	Body      Stmt
+	Increment Expr
 }
 
-func (w *WhileStmt) Accept(v StmtVisitor) interface{} {
+func (w *WhileStmt) Accept(v StmtVisitor) (interface{}, error) {
 	return v.VisitWhileStmt(w)
 }
 
+func (w *WhileStmt) Span() scanner.Span {
+	return w.Keyword.Span().To(w.Body.Span())
+}
+
+// FunStmt declares a function or, when Keyword is nil, a method.
 type FunStmt struct {
-	Name   *scanner.Token
-	Params []*scanner.Token
-	Body   *BlockStmt
+	Keyword *scanner.Token
+	Name    *scanner.Token
+	Params  []*scanner.Token
+	Body    *BlockStmt
 }
 
-func (f *FunStmt) Accept(v StmtVisitor) interface{} {
+func (f *FunStmt) Accept(v StmtVisitor) (interface{}, error) {
 	return v.VisitFunStmt(f)
 }
 
+func (f *FunStmt) Span() scanner.Span {
+	if f.Keyword != nil {
+		return f.Keyword.Span().To(f.Body.Span())
+	}
+
+	return f.Name.Span().To(f.Body.Span())
+}
+
 type ReturnStmt struct {
-	Keyword *scanner.Token
-	Value   Expr
+	Keyword   *scanner.Token
+	Value     Expr
+	Semicolon *scanner.Token
 }
 
-func (r *ReturnStmt) Accept(v StmtVisitor) interface{} {
+func (r *ReturnStmt) Accept(v StmtVisitor) (interface{}, error) {
 	return v.VisitReturnStmt(r)
 }
 
+func (r *ReturnStmt) Span() scanner.Span {
+	if r.Value != nil {
+		return r.Keyword.Span().To(r.Value.Span()).To(tokenSpan(r.Semicolon))
+	}
+
+	return r.Keyword.Span().To(tokenSpan(r.Semicolon))
+}
+
 type ClassStmt struct {
+	Keyword *scanner.Token
 	Name    *scanner.Token
 	Super   *VariableExpr
 	Methods []*FunStmt
+	Close   *scanner.Token
 }
 
-func (c *ClassStmt) Accept(v StmtVisitor) interface{} {
+func (c *ClassStmt) Accept(v StmtVisitor) (interface{}, error) {
 	return v.VisitClassStmt(c)
-}
\ No newline at end of file
+}
+
+func (c *ClassStmt) Span() scanner.Span {
+	return c.Keyword.Span().To(c.Close.Span())
+}
+
+type BreakStmt struct {
+	Keyword   *scanner.Token
+	Semicolon *scanner.Token
+}
+
+func (b *BreakStmt) Accept(v StmtVisitor) (interface{}, error) {
+	return v.VisitBreakStmt(b)
+}
+
+func (b *BreakStmt) Span() scanner.Span {
+	return b.Keyword.Span().To(b.Semicolon.Span())
+}
+
+type ContinueStmt struct {
+	Keyword   *scanner.Token
+	Semicolon *scanner.Token
+}
+
+func (c *ContinueStmt) Accept(v StmtVisitor) (interface{}, error) {
+	return v.VisitContinueStmt(c)
+}
+
+func (c *ContinueStmt) Span() scanner.Span {
+	return c.Keyword.Span().To(c.Semicolon.Span())
+}
+
+// ImportStmt binds the exports of the module at Path to Name.
+type ImportStmt struct {
+	Keyword   *scanner.Token
+	Path      *scanner.Token
+	Name      *scanner.Token
+	Semicolon *scanner.Token
+}
+
+func (i *ImportStmt) Accept(v StmtVisitor) (interface{}, error) {
+	return v.VisitImportStmt(i)
+}
+
+func (i *ImportStmt) Span() scanner.Span {
+	return i.Keyword.Span().To(i.Semicolon.Span())
+}
+
+// ExportStmt makes a top level variable, function or class declaration
+// visible to modules that import the file.
+type ExportStmt struct {
+	Keyword     *scanner.Token
+	Declaration Stmt
+}
+
+func (e *ExportStmt) Accept(v StmtVisitor) (interface{}, error) {
+	return v.VisitExportStmt(e)
+}
+
+func (e *ExportStmt) Span() scanner.Span {
+	return e.Keyword.Span().To(e.Declaration.Span())
+}
+
+// Exported returns the name of the exported declaration.
+func (e *ExportStmt) Exported() *scanner.Token {
+	switch d := e.Declaration.(type) {
+	case *VarStmt:
+		return d.Name
+	case *FunStmt:
+		return d.Name
+	case *ClassStmt:
+		return d.Name
+	}
+
+	return nil
+}
+
+type ThrowStmt struct {
+	Keyword   *scanner.Token
+	Value     Expr
+	Semicolon *scanner.Token
+}
+
+func (t *ThrowStmt) Accept(v StmtVisitor) (interface{}, error) {
+	return v.VisitThrowStmt(t)
+}
+
+func (t *ThrowStmt) Span() scanner.Span {
+	return t.Keyword.Span().To(t.Semicolon.Span())
+}
+
+// TryStmt runs Body and, if it fails, Handler with the error bound to Name.
+// Finally runs last in every case. Either Handler or Finally may be nil, but
+// not both.
+type TryStmt struct {
+	Keyword *scanner.Token
+	Body    *BlockStmt
+	Name    *scanner.Token
+	Handler *BlockStmt
+	Finally *BlockStmt
+}
+
+func (t *TryStmt) Accept(v StmtVisitor) (interface{}, error) {
+	return v.VisitTryStmt(t)
+}
+
+func (t *TryStmt) Span() scanner.Span {
+	if t.Finally != nil {
+		return t.Keyword.Span().To(t.Finally.Span())
+	}
+
+	return t.Keyword.Span().To(t.Handler.Span())
+}
+
+func tokenSpan(t *scanner.Token) scanner.Span {
+	if t == nil {
+		return scanner.Span{}
+	}
+
+	return t.Span()
+}
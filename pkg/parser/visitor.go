@@ -1,28 +1,41 @@
 package parser
 
+// Visitors return an error to abort the traversal. The interpreter uses it to
+// report runtime errors.
 type ExprVisitor interface {
-	VisitBinaryExpr(b *BinaryExpr) interface{}
-	VisitGroupingExpr(g *GroupingExpr) interface{}
-	VisitLiteralExpr(l *LiteralExpr) interface{}
-	VisitUnaryExpr(u *UnaryExpr) interface{}
-	VisitVariableExpr(v *VariableExpr) interface{}
-	VisitAssignExpr(a *AssignExpr) interface{}
-	VisitLogicalExpr(l *LogicalExpr) interface{}
-	VisitCallExpr(c *CallExpr) interface{}
-	VisitGetExpr(g *GetExpr) interface{}
-	VisitSetExpr(s *SetExpr) interface{}
-	VisitThisExpr(t *ThisExpr) interface{}
-	VisitSuperExpr(s *SuperExpr) interface{}
+	VisitBinaryExpr(b *BinaryExpr) (interface{}, error)
+	VisitGroupingExpr(g *GroupingExpr) (interface{}, error)
+	VisitLiteralExpr(l *LiteralExpr) (interface{}, error)
+	VisitUnaryExpr(u *UnaryExpr) (interface{}, error)
+	VisitVariableExpr(v *VariableExpr) (interface{}, error)
+	VisitAssignExpr(a *AssignExpr) (interface{}, error)
+	VisitLogicalExpr(l *LogicalExpr) (interface{}, error)
+	VisitCallExpr(c *CallExpr) (interface{}, error)
+	VisitGetExpr(g *GetExpr) (interface{}, error)
+	VisitSetExpr(s *SetExpr) (interface{}, error)
+	VisitThisExpr(t *ThisExpr) (interface{}, error)
+	VisitSuperExpr(s *SuperExpr) (interface{}, error)
+	VisitListExpr(l *ListExpr) (interface{}, error)
+	VisitIndexExpr(i *IndexExpr) (interface{}, error)
+	VisitIndexSetExpr(i *IndexSetExpr) (interface{}, error)
+	VisitMapExpr(m *MapExpr) (interface{}, error)
+	VisitFunctionExpr(f *FunctionExpr) (interface{}, error)
 }
 
 type StmtVisitor interface {
-	VisitExprStmt(e *ExprStmt) interface{}
-	VisitPrintStmt(p *PrintStmt) interface{}
-	VisitVarStmt(v *VarStmt) interface{}
-	VisitBlockStmt(b *BlockStmt) interface{}
-	VisitIfStmt(i *IfStmt) interface{}
-	VisitWhileStmt(w *WhileStmt) interface{}
-	VisitFunStmt(f *FunStmt) interface{}
-	VisitReturnStmt(r *ReturnStmt) interface{}
-	VisitClassStmt(c *ClassStmt) interface{}
-}
\ No newline at end of file
+	VisitExprStmt(e *ExprStmt) (interface{}, error)
+	VisitPrintStmt(p *PrintStmt) (interface{}, error)
+	VisitVarStmt(v *VarStmt) (interface{}, error)
+	VisitBlockStmt(b *BlockStmt) (interface{}, error)
+	VisitIfStmt(i *IfStmt) (interface{}, error)
+	VisitWhileStmt(w *WhileStmt) (interface{}, error)
+	VisitFunStmt(f *FunStmt) (interface{}, error)
+	VisitReturnStmt(r *ReturnStmt) (interface{}, error)
+	VisitClassStmt(c *ClassStmt) (interface{}, error)
+	VisitBreakStmt(b *BreakStmt) (interface{}, error)
+	VisitContinueStmt(c *ContinueStmt) (interface{}, error)
+	VisitImportStmt(i *ImportStmt) (interface{}, error)
+	VisitExportStmt(e *ExportStmt) (interface{}, error)
+	VisitThrowStmt(t *ThrowStmt) (interface{}, error)
+	VisitTryStmt(t *TryStmt) (interface{}, error)
+}
@@ -0,0 +1,394 @@
+// Package printer renders syntax trees as S-expressions, for inspecting what
+// the parser produced:
+//
+//	(var x (+ 1 (* 2 3)))
+//
+// Statements nested in blocks go on lines of their own, indented by two
+// spaces per level. Tokens and spans are left out; parser.EncodeJSON keeps
+// them.
+package printer
+
+import (
+	"strconv"
+	"strings"
+
+	"golox/pkg/parser"
+	"golox/pkg/scanner"
+)
+
+type Printer struct {
+	b     strings.Builder
+	depth int
+}
+
+func NewPrinter() *Printer {
+	return &Printer{}
+}
+
+// Print returns the S-expressions of stmts, one top level statement per
+// line.
+func Print(stmts []parser.Stmt) string {
+	p := NewPrinter()
+	for _, stmt := range stmts {
+		p.stmt(stmt)
+		p.b.WriteString("\n")
+	}
+
+	return p.b.String()
+}
+
+// PrintExpr returns the S-expression of a single expression.
+func PrintExpr(expr parser.Expr) string {
+	p := NewPrinter()
+	p.expr(expr)
+	return p.b.String()
+}
+
+func (p *Printer) expr(expr parser.Expr) {
+	expr.Accept(p)
+}
+
+func (p *Printer) stmt(stmt parser.Stmt) {
+	stmt.Accept(p)
+}
+
+// open starts a list with the given head.
+func (p *Printer) open(head string) {
+	p.b.WriteString("(")
+	p.b.WriteString(head)
+}
+
+func (p *Printer) close() {
+	p.b.WriteString(")")
+}
+
+func (p *Printer) atom(s string) {
+	p.b.WriteString(" ")
+	p.b.WriteString(s)
+}
+
+func (p *Printer) operand(expr parser.Expr) {
+	p.b.WriteString(" ")
+	p.expr(expr)
+}
+
+// line starts a new line indented to the current depth.
+func (p *Printer) line() {
+	p.b.WriteString("\n")
+	p.b.WriteString(strings.Repeat("  ", p.depth))
+}
+
+// nested writes a statement on a new line one level deeper.
+func (p *Printer) nested(stmt parser.Stmt) {
+	p.depth++
+	p.line()
+	p.stmt(stmt)
+	p.depth--
+}
+
+func (p *Printer) params(params []*scanner.Token) {
+	p.b.WriteString(" (")
+	for k, param := range params {
+		if k > 0 {
+			p.b.WriteString(" ")
+		}
+		p.b.WriteString(param.Lexeme)
+	}
+	p.b.WriteString(")")
+}
+
+func (p *Printer) body(block *parser.BlockStmt) {
+	for _, stmt := range block.Statements {
+		p.nested(stmt)
+	}
+}
+
+func (p *Printer) VisitBinaryExpr(b *parser.BinaryExpr) (interface{}, error) {
+	p.open(b.Operator.Lexeme)
+	p.operand(b.Left)
+	p.operand(b.Right)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitGroupingExpr(g *parser.GroupingExpr) (interface{}, error) {
+	p.open("group")
+	p.operand(g.Expression)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitLiteralExpr(l *parser.LiteralExpr) (interface{}, error) {
+	switch value := l.Value.(type) {
+	case nil:
+		p.b.WriteString("nil")
+	case string:
+		p.b.WriteString(strconv.Quote(value))
+	case float64:
+		p.b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	case bool:
+		p.b.WriteString(strconv.FormatBool(value))
+	}
+	return nil, nil
+}
+
+func (p *Printer) VisitUnaryExpr(u *parser.UnaryExpr) (interface{}, error) {
+	p.open(u.Operator.Lexeme)
+	p.operand(u.Right)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitVariableExpr(v *parser.VariableExpr) (interface{}, error) {
+	p.b.WriteString(v.Name.Lexeme)
+	return nil, nil
+}
+
+func (p *Printer) VisitAssignExpr(a *parser.AssignExpr) (interface{}, error) {
+	p.open("=")
+	p.atom(a.Name.Lexeme)
+	p.operand(a.Value)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitLogicalExpr(l *parser.LogicalExpr) (interface{}, error) {
+	p.open(l.Operator.Lexeme)
+	p.operand(l.Left)
+	p.operand(l.Right)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitCallExpr(c *parser.CallExpr) (interface{}, error) {
+	p.open("call")
+	p.operand(c.Callee)
+	for _, arg := range c.Arguments {
+		p.operand(arg)
+	}
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitGetExpr(g *parser.GetExpr) (interface{}, error) {
+	p.open(".")
+	p.operand(g.Object)
+	p.atom(g.Name.Lexeme)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitSetExpr(s *parser.SetExpr) (interface{}, error) {
+	p.open("=.")
+	p.operand(s.Object)
+	p.atom(s.Name.Lexeme)
+	p.operand(s.Value)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitThisExpr(t *parser.ThisExpr) (interface{}, error) {
+	p.b.WriteString("this")
+	return nil, nil
+}
+
+func (p *Printer) VisitSuperExpr(s *parser.SuperExpr) (interface{}, error) {
+	p.open("super")
+	p.atom(s.Method.Lexeme)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitListExpr(l *parser.ListExpr) (interface{}, error) {
+	p.open("list")
+	for _, element := range l.Elements {
+		p.operand(element)
+	}
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitIndexExpr(i *parser.IndexExpr) (interface{}, error) {
+	p.open("[]")
+	p.operand(i.Object)
+	p.operand(i.Index)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitIndexSetExpr(i *parser.IndexSetExpr) (interface{}, error) {
+	p.open("=[]")
+	p.operand(i.Object)
+	p.operand(i.Index)
+	p.operand(i.Value)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitMapExpr(m *parser.MapExpr) (interface{}, error) {
+	p.open("map")
+	for k := range m.Keys {
+		p.b.WriteString(" (")
+		p.expr(m.Keys[k])
+		p.operand(m.Values[k])
+		p.close()
+	}
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitFunctionExpr(f *parser.FunctionExpr) (interface{}, error) {
+	p.open("fun")
+	p.params(f.Params)
+	p.body(f.Body)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitExprStmt(e *parser.ExprStmt) (interface{}, error) {
+	p.open("expr")
+	p.operand(e.Expression)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitPrintStmt(s *parser.PrintStmt) (interface{}, error) {
+	p.open("print")
+	p.operand(s.Expression)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitVarStmt(v *parser.VarStmt) (interface{}, error) {
+	p.open("var")
+	p.atom(v.Name.Lexeme)
+	if v.Initializer != nil {
+		p.operand(v.Initializer)
+	}
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitBlockStmt(b *parser.BlockStmt) (interface{}, error) {
+	p.open("block")
+	p.body(b)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitIfStmt(i *parser.IfStmt) (interface{}, error) {
+	p.open("if")
+	p.operand(i.Condition)
+	p.nested(i.ThenBranch)
+	if i.ElseBranch != nil {
+		p.nested(i.ElseBranch)
+	}
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitWhileStmt(w *parser.WhileStmt) (interface{}, error) {
+	p.open("while")
+	p.operand(w.Condition)
+	p.nested(w.Body)
+	if w.Increment != nil {
+		p.depth++
+		p.line()
+		p.open("step")
+		p.operand(w.Increment)
+		p.close()
+		p.depth--
+	}
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitFunStmt(f *parser.FunStmt) (interface{}, error) {
+	p.open("fun")
+	p.atom(f.Name.Lexeme)
+	p.params(f.Params)
+	p.body(f.Body)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitReturnStmt(r *parser.ReturnStmt) (interface{}, error) {
+	p.open("return")
+	if r.Value != nil {
+		p.operand(r.Value)
+	}
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitClassStmt(c *parser.ClassStmt) (interface{}, error) {
+	p.open("class")
+	p.atom(c.Name.Lexeme)
+	if c.Super != nil {
+		p.b.WriteString(" (< ")
+		p.expr(c.Super)
+		p.close()
+	}
+	for _, method := range c.Methods {
+		p.nested(method)
+	}
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitBreakStmt(b *parser.BreakStmt) (interface{}, error) {
+	p.b.WriteString("(break)")
+	return nil, nil
+}
+
+func (p *Printer) VisitContinueStmt(c *parser.ContinueStmt) (interface{}, error) {
+	p.b.WriteString("(continue)")
+	return nil, nil
+}
+
+func (p *Printer) VisitImportStmt(i *parser.ImportStmt) (interface{}, error) {
+	p.open("import")
+	p.atom(strconv.Quote(i.Path.Literal.(string)))
+	p.atom(i.Name.Lexeme)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitExportStmt(e *parser.ExportStmt) (interface{}, error) {
+	p.open("export")
+	p.b.WriteString(" ")
+	p.stmt(e.Declaration)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitThrowStmt(t *parser.ThrowStmt) (interface{}, error) {
+	p.open("throw")
+	p.operand(t.Value)
+	p.close()
+	return nil, nil
+}
+
+func (p *Printer) VisitTryStmt(t *parser.TryStmt) (interface{}, error) {
+	p.open("try")
+	p.nested(t.Body)
+	if t.Handler != nil {
+		p.depth++
+		p.line()
+		p.open("catch")
+		p.atom(t.Name.Lexeme)
+		p.body(t.Handler)
+		p.close()
+		p.depth--
+	}
+	if t.Finally != nil {
+		p.depth++
+		p.line()
+		p.open("finally")
+		p.body(t.Finally)
+		p.close()
+		p.depth--
+	}
+	p.close()
+	return nil, nil
+}
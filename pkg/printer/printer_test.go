@@ -0,0 +1,43 @@
+package printer
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golox/pkg/parser"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// TestGolden prints the program the parser tests use, which has every kind
+// of node, and compares the result with testdata/all.sexp, which is what
+// golox ast prints for it.
+func TestGolden(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("..", "parser", "testdata", "all.lox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stmts, err := parser.ParseSource(string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	printed := Print(stmts)
+	golden := filepath.Join("testdata", "all.sexp")
+	if *update {
+		if err := os.WriteFile(golden, []byte(printed), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if printed != string(want) {
+		t.Errorf("printed tree differs from %s:\n%s", golden, printed)
+	}
+}
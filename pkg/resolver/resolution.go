@@ -0,0 +1,72 @@
+package resolver
+
+import (
+	"golox/pkg/fault"
+	"golox/pkg/parser"
+	"golox/pkg/scanner"
+)
+
+const (
+	D_VARIABLE  = 0
+	D_FUNCTION  = 1
+	D_CLASS     = 2
+	D_PARAMETER = 3
+	D_IMPORT    = 4
+	D_ERROR     = 5
+	D_IMPLICIT  = 6
+)
+
+// Local locates a local variable: Depth scopes out from the reference, in
+// the given Slot. Slots number the variables of a scope in declaration
+// order.
+type Local struct {
+	Depth int
+	Slot  int
+}
+
+// Declaration is a variable, function, class, parameter, import or caught
+// error. Global declarations have no slot. Captured is set when a function
+// nested inside the declaring one refers to the variable, so that it must
+// outlive the call.
+type Declaration struct {
+	Name     *scanner.Token
+	Kind     int
+	Global   bool
+	Slot     int
+	Captured bool
+}
+
+// Resolution is what the resolver found out about a program. Locals holds
+// the location of every local variable, this and super expression, and
+// Globals the name of every other variable and assignment expression.
+// TopLevel lists the expressions in Locals and Globals that are outside
+// every function, which cannot run again once the program has. References
+// maps the variable and assignment expressions to the declaration they refer
+// to, where it is part of the program or, for a resolver that remembers, of
+// an earlier one. Declarations are listed in source order. Warnings point out
+// likely mistakes that do not stop the program from running.
+type Resolution struct {
+	Locals       map[parser.Expr]Local
+	Globals      map[parser.Expr]string
+	TopLevel     []parser.Expr
+	References   map[parser.Expr]*Declaration
+	Declarations []*Declaration
+	Warnings     fault.List
+}
+
+func newResolution() *Resolution {
+	return &Resolution{make(map[parser.Expr]Local), make(map[parser.Expr]string), nil, make(map[parser.Expr]*Declaration), nil, nil}
+}
+
+// Captured lists the local declarations that are referred to from nested
+// functions.
+func (r *Resolution) Captured() []*Declaration {
+	captured := []*Declaration{}
+	for _, decl := range r.Declarations {
+		if decl.Captured {
+			captured = append(captured, decl)
+		}
+	}
+
+	return captured
+}
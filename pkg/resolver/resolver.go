@@ -1,8 +1,9 @@
 package resolver
 
 import (
+	"sort"
+
 	"golox/pkg/fault"
-	"golox/pkg/interpreter"
 	"golox/pkg/parser"
 	"golox/pkg/scanner"
 )
@@ -17,128 +18,182 @@ const (
 	C_SUBCLASS = 2
 )
 
+// variable tracks a local declaration while its scope is open. The implicit
+// this and super bindings have a declaration without a name that is not
+// part of the resolution.
+type variable struct {
+	decl    *Declaration
+	defined bool
+}
+
+// Resolver works out which declaration every variable refers to. function
+// is the index of the outermost scope of the innermost function, so that
+// references to scopes further out are captures. known holds the globals
+// declared by earlier programs when the resolver remembers them, see
+// Remember.
 type Resolver struct {
-	i      *interpreter.Interpreter
-	scopes []map[string]bool
-	ftype  int
-	ctype  int
+	res      *Resolution
+	scopes   []map[string]*variable
+	function int
+	ftype    int
+	ctype    int
+	loops    int
+	known    map[string]*Declaration
+	builtins map[string]bool
 }
 
-func NewResolver(i *interpreter.Interpreter) *Resolver {
-	return &Resolver{i, []map[string]bool{}, F_NONE, C_NONE}
+func NewResolver() *Resolver {
+	return &Resolver{nil, []map[string]*variable{}, 0, F_NONE, C_NONE, 0, nil, nil}
 }
 
-func (r *Resolver) Resolve(stmts []parser.Stmt) (err error) {
+// Remember makes the resolver keep the globals declared by every program it
+// resolves successfully, for a REPL that resolves its inputs one at a time.
+// References to globals that neither an earlier nor the current program
+// declares, and that are not among builtins, are then reported as warnings.
+func (r *Resolver) Remember(builtins []string) {
+	r.known = make(map[string]*Declaration)
+	r.builtins = make(map[string]bool)
+	for _, name := range builtins {
+		r.builtins[name] = true
+	}
+}
+
+// Resolve checks stmts and returns what it found out about their variables.
+// Declarations and references to globals are matched by name once the whole
+// program has been seen, since globals are late bound.
+func (r *Resolver) Resolve(stmts []parser.Stmt) (res *Resolution, err error) {
 	defer func() {
 		if r_ := recover(); r_ != nil {
-			err = r_.(error)
+			d, ok := r_.(*fault.Diagnostic)
+			if !ok {
+				panic(r_)
+			}
+			res, err = nil, fault.List{d}
 		}
 	}()
 
+	r.res = newResolution()
 	for _, stmt := range stmts {
 		stmt.Accept(r)
 	}
 
-	return err
+	r.bindGlobals()
+	if r.known != nil {
+		for _, decl := range r.res.Declarations {
+			if decl.Global {
+				r.known[decl.Name.Lexeme] = decl
+			}
+		}
+	}
+
+	return r.res, nil
 }
 
-func (r *Resolver) VisitExprStmt(e *parser.ExprStmt) interface{} {
+func (r *Resolver) VisitExprStmt(e *parser.ExprStmt) (interface{}, error) {
 	e.Expression.Accept(r)
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitPrintStmt(p *parser.PrintStmt) interface{} {
+func (r *Resolver) VisitPrintStmt(p *parser.PrintStmt) (interface{}, error) {
 	p.Expression.Accept(r)
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitVarStmt(v *parser.VarStmt) interface{} {
-	r.declare(v.Name)
+func (r *Resolver) VisitVarStmt(v *parser.VarStmt) (interface{}, error) {
+	r.declare(v.Name, D_VARIABLE)
 	if v.Initializer != nil {
 		v.Initializer.Accept(r)
 	}
 	r.define(v.Name)
 
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitBlockStmt(b *parser.BlockStmt) interface{} {
-	r.scopes = append(r.scopes, make(map[string]bool))
+func (r *Resolver) VisitBlockStmt(b *parser.BlockStmt) (interface{}, error) {
+	r.scopes = append(r.scopes, make(map[string]*variable))
 	for _, stmt := range b.Statements {
 		stmt.Accept(r)
 	}
 	r.scopes = r.scopes[:len(r.scopes)-1]
 
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitIfStmt(i *parser.IfStmt) interface{} {
+func (r *Resolver) VisitIfStmt(i *parser.IfStmt) (interface{}, error) {
 	i.Condition.Accept(r)
 	i.ThenBranch.Accept(r)
 	if i.ElseBranch != nil {
 		i.ElseBranch.Accept(r)
 	}
 
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitWhileStmt(w *parser.WhileStmt) interface{} {
+func (r *Resolver) VisitWhileStmt(w *parser.WhileStmt) (interface{}, error) {
 	w.Condition.Accept(r)
+	r.loops++
 	w.Body.Accept(r)
-	return nil
+	r.loops--
+	if w.Increment != nil {
+		w.Increment.Accept(r)
+	}
+
+	return nil, nil
 }
 
-func (r *Resolver) VisitFunStmt(f *parser.FunStmt) interface{} {
-	r.declare(f.Name)
+func (r *Resolver) VisitFunStmt(f *parser.FunStmt) (interface{}, error) {
+	r.declare(f.Name, D_FUNCTION)
 	r.define(f.Name)
-	r.resolveFunction(f, F_FUNCTION)
-	return nil
+	r.resolveFunction(f.Params, f.Body, F_FUNCTION)
+	return nil, nil
 }
 
-func (r *Resolver) VisitReturnStmt(r_ *parser.ReturnStmt) interface{} {
+func (r *Resolver) VisitReturnStmt(r_ *parser.ReturnStmt) (interface{}, error) {
 	if r.ftype == F_NONE {
-		panic(fault.NewFault(r_.Keyword.Line, "cannot return outside of a function"))
+		panic(r.error(fault.INVALID_RETURN, r_.Keyword, "cannot return outside of a function"))
 	}
 
 	if r_.Value != nil {
 		if r.ftype == F_INIT {
-			panic(fault.NewFault(r_.Keyword.Line, "cannot return a value from an initializer"))
+			panic(r.error(fault.INVALID_RETURN, r_.Keyword, "cannot return a value from an initializer"))
 		}
 
 		r_.Value.Accept(r)
 	}
 
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitClassStmt(c *parser.ClassStmt) interface{} {
+func (r *Resolver) VisitClassStmt(c *parser.ClassStmt) (interface{}, error) {
 	enclosing := r.ctype
 	r.ctype = C_CLASS
-	r.declare(c.Name)
+	r.declare(c.Name, D_CLASS)
 	r.define(c.Name)
 	if c.Super != nil {
 		if c.Name.Lexeme == c.Super.Name.Lexeme {
-			panic(fault.NewFault(c.Super.Name.Line, "a class cannot inherit from itself"))
+			d := r.error(fault.SELF_INHERITANCE, c.Super.Name, "a class cannot inherit from itself")
+			d.AddLabel(c.Name.Line, c.Name.Column, c.Name.Start, c.Name.End, "class declared here")
+			panic(d)
 		}
 		r.ctype = C_SUBCLASS
 		c.Super.Accept(r)
 	}
 
 	if c.Super != nil {
-		r.scopes = append(r.scopes, make(map[string]bool))
+		r.scopes = append(r.scopes, make(map[string]*variable))
 		scope := r.scopes[len(r.scopes)-1]
-		scope["super"] = true
+		scope["super"] = &variable{&Declaration{nil, D_IMPLICIT, false, 0, false}, true}
 	}
 
-	r.scopes = append(r.scopes, make(map[string]bool))
+	r.scopes = append(r.scopes, make(map[string]*variable))
 	scope := r.scopes[len(r.scopes)-1]
-	scope["this"] = true
+	scope["this"] = &variable{&Declaration{nil, D_IMPLICIT, false, 0, false}, true}
 
 	for _, method := range c.Methods {
 		if method.Name.Lexeme == "init" {
-			r.resolveFunction(method, F_INIT)
+			r.resolveFunction(method.Params, method.Body, F_INIT)
 		} else {
-			r.resolveFunction(method, F_METHOD)
+			r.resolveFunction(method.Params, method.Body, F_METHOD)
 		}
 	}
 
@@ -148,135 +203,291 @@ func (r *Resolver) VisitClassStmt(c *parser.ClassStmt) interface{} {
 	}
 
 	r.ctype = enclosing
-	return nil
+	return nil, nil
+}
+
+func (r *Resolver) VisitBreakStmt(b *parser.BreakStmt) (interface{}, error) {
+	if r.loops == 0 {
+		panic(r.error(fault.INVALID_JUMP, b.Keyword, "cannot break outside of a loop"))
+	}
+
+	return nil, nil
+}
+
+func (r *Resolver) VisitContinueStmt(c *parser.ContinueStmt) (interface{}, error) {
+	if r.loops == 0 {
+		panic(r.error(fault.INVALID_JUMP, c.Keyword, "cannot continue outside of a loop"))
+	}
+
+	return nil, nil
+}
+
+func (r *Resolver) VisitImportStmt(i *parser.ImportStmt) (interface{}, error) {
+	r.declare(i.Name, D_IMPORT)
+	r.define(i.Name)
+	return nil, nil
+}
+
+func (r *Resolver) VisitExportStmt(e *parser.ExportStmt) (interface{}, error) {
+	if len(r.scopes) > 0 {
+		panic(r.error(fault.INVALID_EXPORT, e.Keyword, "can only export top level declarations"))
+	}
+
+	e.Declaration.Accept(r)
+	return nil, nil
+}
+
+func (r *Resolver) VisitThrowStmt(t *parser.ThrowStmt) (interface{}, error) {
+	t.Value.Accept(r)
+	return nil, nil
+}
+
+// VisitTryStmt resolves the handler in the scope that binds the error, the
+// way a function body shares the scope of its parameters.
+func (r *Resolver) VisitTryStmt(t *parser.TryStmt) (interface{}, error) {
+	t.Body.Accept(r)
+	if t.Handler != nil {
+		r.scopes = append(r.scopes, make(map[string]*variable))
+		r.declare(t.Name, D_ERROR)
+		r.define(t.Name)
+		for _, stmt := range t.Handler.Statements {
+			stmt.Accept(r)
+		}
+		r.scopes = r.scopes[:len(r.scopes)-1]
+	}
+
+	if t.Finally != nil {
+		t.Finally.Accept(r)
+	}
+
+	return nil, nil
 }
 
-func (r *Resolver) VisitBinaryExpr(b *parser.BinaryExpr) interface{} {
+func (r *Resolver) VisitBinaryExpr(b *parser.BinaryExpr) (interface{}, error) {
 	b.Left.Accept(r)
 	b.Right.Accept(r)
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitGroupingExpr(g *parser.GroupingExpr) interface{} {
+func (r *Resolver) VisitGroupingExpr(g *parser.GroupingExpr) (interface{}, error) {
 	g.Expression.Accept(r)
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitLiteralExpr(l *parser.LiteralExpr) interface{} {
-	return nil
+func (r *Resolver) VisitLiteralExpr(l *parser.LiteralExpr) (interface{}, error) {
+	return nil, nil
 }
 
-func (r *Resolver) VisitUnaryExpr(u *parser.UnaryExpr) interface{} {
+func (r *Resolver) VisitUnaryExpr(u *parser.UnaryExpr) (interface{}, error) {
 	u.Right.Accept(r)
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitVariableExpr(v *parser.VariableExpr) interface{} {
+func (r *Resolver) VisitVariableExpr(v *parser.VariableExpr) (interface{}, error) {
 	if len(r.scopes) > 0 {
 		scope := r.scopes[len(r.scopes)-1]
-		if value, ok := scope[v.Name.Lexeme]; ok && !value {
-			panic(fault.NewFault(v.Name.Line, "cannot read local variable in its own initializer"))
+		if value, ok := scope[v.Name.Lexeme]; ok && !value.defined {
+			panic(r.error(fault.SELF_REFERENCE, v.Name, "cannot read local variable in its own initializer"))
 		}
 	}
 
 	r.resolveLocal(v, v.Name)
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitAssignExpr(a *parser.AssignExpr) interface{} {
+func (r *Resolver) VisitAssignExpr(a *parser.AssignExpr) (interface{}, error) {
 	a.Value.Accept(r)
 	r.resolveLocal(a, a.Name)
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitLogicalExpr(l *parser.LogicalExpr) interface{} {
+func (r *Resolver) VisitLogicalExpr(l *parser.LogicalExpr) (interface{}, error) {
 	l.Left.Accept(r)
 	l.Right.Accept(r)
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitCallExpr(c *parser.CallExpr) interface{} {
+func (r *Resolver) VisitCallExpr(c *parser.CallExpr) (interface{}, error) {
 	c.Callee.Accept(r)
 	for _, arg := range c.Arguments {
 		arg.Accept(r)
 	}
 
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitGetExpr(g *parser.GetExpr) interface{} {
+func (r *Resolver) VisitGetExpr(g *parser.GetExpr) (interface{}, error) {
 	g.Object.Accept(r)
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitSetExpr(s *parser.SetExpr) interface{} {
+func (r *Resolver) VisitSetExpr(s *parser.SetExpr) (interface{}, error) {
 	s.Value.Accept(r)
 	s.Object.Accept(r)
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitThisExpr(t *parser.ThisExpr) interface{} {
+func (r *Resolver) VisitThisExpr(t *parser.ThisExpr) (interface{}, error) {
 	if r.ctype == C_NONE {
-		panic(fault.NewFault(t.Keyword.Line, "cannot use 'this' outside of a class"))
+		panic(r.error(fault.INVALID_CLASS_USE, t.Keyword, "cannot use 'this' outside of a class"))
 	}
 
 	r.resolveLocal(t, t.Keyword)
-	return nil
+	return nil, nil
 }
 
-func (r *Resolver) VisitSuperExpr(s *parser.SuperExpr) interface{} {
+func (r *Resolver) VisitSuperExpr(s *parser.SuperExpr) (interface{}, error) {
 	if r.ctype == C_NONE {
-		panic(fault.NewFault(s.Keyword.Line, "cannot use 'super' outside of a class"))
+		panic(r.error(fault.INVALID_CLASS_USE, s.Keyword, "cannot use 'super' outside of a class"))
 	}
 
 	if r.ctype == C_CLASS {
-		panic(fault.NewFault(s.Keyword.Line, "cannot use 'super' in a class with no superclass"))
+		panic(r.error(fault.INVALID_CLASS_USE, s.Keyword, "cannot use 'super' in a class with no superclass"))
 	}
 
 	r.resolveLocal(s, s.Keyword)
-	return nil
+	return nil, nil
+}
+
+func (r *Resolver) VisitListExpr(l *parser.ListExpr) (interface{}, error) {
+	for _, element := range l.Elements {
+		element.Accept(r)
+	}
+
+	return nil, nil
+}
+
+func (r *Resolver) VisitIndexExpr(i *parser.IndexExpr) (interface{}, error) {
+	i.Object.Accept(r)
+	i.Index.Accept(r)
+	return nil, nil
+}
+
+func (r *Resolver) VisitIndexSetExpr(i *parser.IndexSetExpr) (interface{}, error) {
+	i.Value.Accept(r)
+	i.Object.Accept(r)
+	i.Index.Accept(r)
+	return nil, nil
 }
 
-func (r *Resolver) declare(name *scanner.Token) {
+func (r *Resolver) VisitMapExpr(m *parser.MapExpr) (interface{}, error) {
+	for k, key := range m.Keys {
+		key.Accept(r)
+		m.Values[k].Accept(r)
+	}
+
+	return nil, nil
+}
+
+func (r *Resolver) VisitFunctionExpr(f *parser.FunctionExpr) (interface{}, error) {
+	r.resolveFunction(f.Params, f.Body, F_FUNCTION)
+	return nil, nil
+}
+
+// declare records a declaration and, unless it is global, opens its slot in
+// the innermost scope.
+func (r *Resolver) declare(name *scanner.Token, kind int) {
+	decl := &Declaration{name, kind, true, -1, false}
 	if len(r.scopes) > 0 {
 		scope := r.scopes[len(r.scopes)-1]
-		if _, ok := scope[name.Lexeme]; ok {
-			panic(fault.NewFault(name.Line, "variable cannot be redeclared in local scope"))
+		if previous, ok := scope[name.Lexeme]; ok {
+			first := previous.decl.Name
+			d := r.error(fault.REDECLARED_VARIABLE, name, "variable cannot be redeclared in local scope")
+			d.AddLabel(first.Line, first.Column, first.Start, first.End, "first declared here")
+			panic(d)
 		}
-		scope[name.Lexeme] = false
+		decl.Global, decl.Slot = false, len(scope)
+		scope[name.Lexeme] = &variable{decl, false}
 	}
+
+	r.res.Declarations = append(r.res.Declarations, decl)
 }
 
 func (r *Resolver) define(name *scanner.Token) {
 	if len(r.scopes) > 0 {
 		scope := r.scopes[len(r.scopes)-1]
-		scope[name.Lexeme] = true
+		scope[name.Lexeme].defined = true
 	}
 }
 
+// resolveLocal records where the variable that expr refers to lives. Names
+// not found in any scope are globals, which are matched up at the end.
 func (r *Resolver) resolveLocal(expr parser.Expr, name *scanner.Token) {
 	for i := len(r.scopes) - 1; i >= 0; i-- {
-		if _, ok := r.scopes[i][name.Lexeme]; ok {
-			r.i.Resolve(expr, len(r.scopes)-i-1)
+		if v, ok := r.scopes[i][name.Lexeme]; ok {
+			r.res.Locals[expr] = Local{len(r.scopes) - i - 1, v.decl.Slot}
+			if r.ftype == F_NONE {
+				r.res.TopLevel = append(r.res.TopLevel, expr)
+			}
+			if v.decl.Name != nil {
+				r.res.References[expr] = v.decl
+			}
+			if i < r.function {
+				v.decl.Captured = true
+			}
 			return
 		}
 	}
+
+	r.res.Globals[expr] = name.Lexeme
+	if r.ftype == F_NONE {
+		r.res.TopLevel = append(r.res.TopLevel, expr)
+	}
 }
 
-func (r *Resolver) resolveFunction(function *parser.FunStmt, ftype int) {
-	enclosing := r.ftype
-	r.ftype = ftype
-	r.scopes = append(r.scopes, make(map[string]bool))
+func (r *Resolver) bindGlobals() {
+	decls := make(map[string]*Declaration)
+	for name, decl := range r.known {
+		decls[name] = decl
+	}
+	for _, decl := range r.res.Declarations {
+		if decl.Global {
+			decls[decl.Name.Lexeme] = decl
+		}
+	}
+
+	for expr, name := range r.res.Globals {
+		if decl, ok := decls[name]; ok {
+			r.res.References[expr] = decl
+		} else if r.known != nil && !r.builtins[name] {
+			d := r.error(fault.UNDEFINED_GLOBAL, globalName(expr), "undefined variable "+name)
+			d.Severity = fault.WARNING
+			r.res.Warnings = append(r.res.Warnings, d)
+		}
+	}
+
+	sort.Slice(r.res.Warnings, func(i, j int) bool {
+		return r.res.Warnings[i].Span.Start < r.res.Warnings[j].Span.Start
+	})
+}
 
-	for _, param := range function.Params {
-		r.declare(param)
+// globalName returns the name token of a reference to a global.
+func globalName(expr parser.Expr) *scanner.Token {
+	if a, ok := expr.(*parser.AssignExpr); ok {
+		return a.Name
+	}
+
+	return expr.(*parser.VariableExpr).Name
+}
+
+func (r *Resolver) resolveFunction(params []*scanner.Token, body *parser.BlockStmt, ftype int) {
+	enclosing, loops, function := r.ftype, r.loops, r.function
+	r.ftype, r.loops, r.function = ftype, 0, len(r.scopes)
+	r.scopes = append(r.scopes, make(map[string]*variable))
+
+	for _, param := range params {
+		r.declare(param, D_PARAMETER)
 		r.define(param)
 	}
 
-	for _, stmt := range function.Body.Statements {
+	for _, stmt := range body.Statements {
 		stmt.Accept(r)
 	}
 
 	r.scopes = r.scopes[:len(r.scopes)-1]
-	r.ftype = enclosing
-}
\ No newline at end of file
+	r.ftype, r.loops, r.function = enclosing, loops, function
+}
+
+func (r *Resolver) error(code string, token *scanner.Token, message string) *fault.Diagnostic {
+	return fault.NewDiagnosticAt(code, token.Line, token.Column, token.Start, token.End, message)
+}
@@ -3,27 +3,37 @@ package scanner
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"golox/pkg/fault"
 )
 
 type scanner struct {
-	Source  string
-	Tokens  []Token
-	start   int
-	current int
-	line    int
-	err     error
+	Source    string
+	Tokens    []Token
+	Comments  []Token
+	start     int
+	current   int
+	line      int
+	lineStart int
+	startLine int
+	startCol  int
+	diags     fault.List
 }
 
 func NewScanner(source string) *scanner {
 	tokens := make([]Token, 0, 10)
-	return &scanner{source, tokens, 0, 0, 1, nil}
+	return &scanner{source, tokens, nil, 0, 0, 1, 0, 1, 1, nil}
 }
 
+// ScanTokens tokenizes the whole source. The returned error is a fault.List
+// holding every problem found.
 func (s *scanner) ScanTokens() error {
 	for s.current < len(s.Source) {
 		s.start = s.current
+		s.startLine = s.line
+		s.startCol = s.start - s.lineStart + 1
 		switch s.Source[s.current] {
 		case '(':
 			s.addToken(LEFT_PAREN, nil)
@@ -33,8 +43,14 @@ func (s *scanner) ScanTokens() error {
 			s.addToken(LEFT_BRACE, nil)
 		case '}':
 			s.addToken(RIGHT_BRACE, nil)
+		case '[':
+			s.addToken(LEFT_BRACKET, nil)
+		case ']':
+			s.addToken(RIGHT_BRACKET, nil)
 		case ',':
 			s.addToken(COMMA, nil)
+		case ':':
+			s.addToken(COLON, nil)
 		case '.':
 			s.addToken(DOT, nil)
 		case '-':
@@ -54,6 +70,8 @@ func (s *scanner) ScanTokens() error {
 		case '=':
 			if s.next('=') {
 				s.addToken(EQUAL_EQUAL, nil)
+			} else if s.next('>') {
+				s.addToken(ARROW, nil)
 			} else {
 				s.addToken(EQUAL, nil)
 			}
@@ -79,51 +97,71 @@ func (s *scanner) ScanTokens() error {
 		case '\t':
 		case '\r':
 		case '\n':
-			s.line++
+			s.newline()
 		case '"':
-			err := s.string()
-			if s.err == nil {
-				s.err = err
-			}
+			s.string()
 		default:
 			if isDigit(s.Source[s.current]) {
 				s.number()
 			} else if isAlpha(s.Source[s.current]) {
 				s.identifier()
 			} else {
-				message := fmt.Sprintf("unknown character '%c'", s.Source[s.current])
-				s.err = fault.NewFault(s.line, message)
+				// the whole character becomes one error token
+				r, width := utf8.DecodeRuneInString(s.Source[s.current:])
+				s.current += width - 1
+				message := fmt.Sprintf("unknown character '%c'", r)
+				s.error(fault.UNKNOWN_CHARACTER, message)
 			}
 		}
 		s.current++
 	}
-	s.Tokens = append(s.Tokens, Token{EOF, "EOF", nil, s.line})
-	return s.err
+	column := len(s.Source) - s.lineStart + 1
+	s.Tokens = append(s.Tokens, Token{EOF, "EOF", nil, s.line, column, len(s.Source), len(s.Source)})
+	return s.diags.Err()
+}
+
+func (s *scanner) newline() {
+	s.line++
+	s.lineStart = s.current + 1
+}
+
+// error reports a problem with the current lexeme and turns it into an ERROR
+// token.
+func (s *scanner) error(code string, message string) {
+	d := fault.NewDiagnosticAt(code, s.startLine, s.startCol, s.start, s.current+1, message)
+	s.diags = append(s.diags, d)
+	s.addToken(ERROR, nil)
 }
 
+// singleComment skips a comment, keeping it in Comments without the line
+// break that ends it.
 func (s *scanner) singleComment() {
 	for s.current < len(s.Source) && s.Source[s.current] != '\n' {
 		s.current++
 	}
 	s.current--
+
+	lexeme := strings.TrimRight(s.Source[s.start:s.current+1], " \t\r")
+	comment := Token{COMMENT, lexeme, nil, s.startLine, s.startCol, s.start, s.start + len(lexeme)}
+	s.Comments = append(s.Comments, comment)
 }
 
-func (s *scanner) string() error {
+func (s *scanner) string() {
 	s.current++
 	for s.current < len(s.Source) && s.Source[s.current] != '"' {
 		if s.Source[s.current] == '\n' {
-			s.line++
+			s.newline()
 		}
 		s.current++
 	}
 
 	if s.current == len(s.Source) {
-		return fault.NewFault(s.line, "unterminated string")
+		s.current--
+		s.error(fault.UNTERMINATED_STRING, "unterminated string")
+		s.current++
 	} else {
 		s.addToken(STRING, s.Source[s.start+1:s.current])
 	}
-
-	return nil
 }
 
 func (s *scanner) number() {
@@ -161,12 +199,12 @@ func (s *scanner) identifier() {
 
 func (s *scanner) addToken(tokenType int, literal interface{}) {
 	lexeme := s.Source[s.start : s.current+1]
-	token := Token{tokenType, lexeme, literal, s.line}
+	token := Token{tokenType, lexeme, literal, s.startLine, s.startCol, s.start, s.current + 1}
 	s.Tokens = append(s.Tokens, token)
 }
 
 func (s *scanner) next(c byte) bool {
-	if s.current < len(s.Source)-1 && s.Source[s.current+1] != c {
+	if s.current+1 >= len(s.Source) || s.Source[s.current+1] != c {
 		return false
 	}
 
@@ -180,4 +218,4 @@ func isDigit(c byte) bool {
 
 func isAlpha(c byte) bool {
 	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
-}
\ No newline at end of file
+}
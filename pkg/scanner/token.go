@@ -1,5 +1,10 @@
 package scanner
 
+import (
+	"fmt"
+	"sort"
+)
+
 const (
 	// single-character tokens
 	LEFT_PAREN  = -1
@@ -48,30 +53,192 @@ const (
 	WHILE  = -38
 
 	EOF = -39
+
+	// keywords added after EOF to keep the original numbering stable
+	BREAK    = -40
+	CONTINUE = -41
+
+	LEFT_BRACKET  = -42
+	RIGHT_BRACKET = -43
+	COLON         = -44
+	ARROW         = -45
+
+	IMPORT = -46
+	EXPORT = -47
+
+	THROW   = -48
+	TRY     = -49
+	CATCH   = -50
+	FINALLY = -51
+
+	// ERROR stands in for text the scanner could not make sense of, so that
+	// parsing can go on. The scanner has already reported it.
+	ERROR = -52
+
+	// COMMENT is a // comment. Comments are kept apart from the tokens the
+	// parser sees, for tools such as the formatter.
+	COMMENT = -53
 )
 
 var keywords = map[string]int{
-	"and":    AND,
-	"class":  CLASS,
-	"else":   ELSE,
-	"false":  FALSE,
-	"for":    FOR,
-	"fun":    FUN,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
-	"print":  PRINT,
-	"return": RETURN,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"var":    VAR,
-	"while":  WHILE,
+	"and":      AND,
+	"break":    BREAK,
+	"catch":    CATCH,
+	"class":    CLASS,
+	"continue": CONTINUE,
+	"else":     ELSE,
+	"export":   EXPORT,
+	"false":    FALSE,
+	"finally":  FINALLY,
+	"for":      FOR,
+	"fun":      FUN,
+	"if":       IF,
+	"import":   IMPORT,
+	"nil":      NIL,
+	"or":       OR,
+	"print":    PRINT,
+	"return":   RETURN,
+	"super":    SUPER,
+	"this":     THIS,
+	"throw":    THROW,
+	"true":     TRUE,
+	"try":      TRY,
+	"var":      VAR,
+	"while":    WHILE,
 }
 
+var names = map[int]string{
+	LEFT_PAREN:    "LEFT_PAREN",
+	RIGHT_PAREN:   "RIGHT_PAREN",
+	LEFT_BRACE:    "LEFT_BRACE",
+	RIGHT_BRACE:   "RIGHT_BRACE",
+	COMMA:         "COMMA",
+	DOT:           "DOT",
+	MINUS:         "MINUS",
+	PLUS:          "PLUS",
+	SEMICOLON:     "SEMICOLON",
+	SLASH:         "SLASH",
+	STAR:          "STAR",
+	BANG:          "BANG",
+	BANG_EQUAL:    "BANG_EQUAL",
+	EQUAL:         "EQUAL",
+	EQUAL_EQUAL:   "EQUAL_EQUAL",
+	GREATER:       "GREATER",
+	GREATER_EQUAL: "GREATER_EQUAL",
+	LESS:          "LESS",
+	LESS_EQUAL:    "LESS_EQUAL",
+	IDENTIFIER:    "IDENTIFIER",
+	STRING:        "STRING",
+	NUMBER:        "NUMBER",
+	AND:           "AND",
+	CLASS:         "CLASS",
+	ELSE:          "ELSE",
+	FALSE:         "FALSE",
+	FUN:           "FUN",
+	FOR:           "FOR",
+	IF:            "IF",
+	NIL:           "NIL",
+	OR:            "OR",
+	PRINT:         "PRINT",
+	RETURN:        "RETURN",
+	SUPER:         "SUPER",
+	THIS:          "THIS",
+	TRUE:          "TRUE",
+	VAR:           "VAR",
+	WHILE:         "WHILE",
+	EOF:           "EOF",
+	BREAK:         "BREAK",
+	CONTINUE:      "CONTINUE",
+	LEFT_BRACKET:  "LEFT_BRACKET",
+	RIGHT_BRACKET: "RIGHT_BRACKET",
+	COLON:         "COLON",
+	ARROW:         "ARROW",
+	IMPORT:        "IMPORT",
+	EXPORT:        "EXPORT",
+	THROW:         "THROW",
+	TRY:           "TRY",
+	CATCH:         "CATCH",
+	FINALLY:       "FINALLY",
+	ERROR:         "ERROR",
+	COMMENT:       "COMMENT",
+}
+
+// TypeName returns the name of a token type as spelled in this package, such
+// as "LEFT_PAREN".
+func TypeName(tokenType int) string {
+	if name, ok := names[tokenType]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("TOKEN(%d)", tokenType)
+}
+
+// TypeOf returns the token type that TypeName names.
+func TypeOf(name string) (int, bool) {
+	for tokenType, n := range names {
+		if n == name {
+			return tokenType, true
+		}
+	}
+
+	return 0, false
+}
+
+// Keywords returns the reserved words in alphabetical order.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+
+	sort.Strings(words)
+	return words
+}
+
+// Token is a lexeme together with its location. Line and Column are 1-based
+// and point at the first character, Start and End are byte offsets into the
+// source with End exclusive.
 type Token struct {
 	TokenType int
 	Lexeme    string
 	Literal   interface{}
 	Line      int
+	Column    int
+	Start     int
+	End       int
+}
+
+func (t *Token) Span() Span {
+	return Span{t.Start, t.End, t.Line, t.Column}
+}
+
+// Span is a range of source text. Start and End are byte offsets with End
+// exclusive, Line and Column locate Start. The zero Span means the location
+// is unknown, as for nodes the parser synthesizes.
+type Span struct {
+	Start  int
+	End    int
+	Line   int
+	Column int
+}
+
+// To returns the smallest span covering both s and other.
+func (s Span) To(other Span) Span {
+	if s.Line == 0 {
+		return other
+	}
+
+	if other.Line == 0 {
+		return s
+	}
+
+	if other.Start < s.Start {
+		s.Start, s.Line, s.Column = other.Start, other.Line, other.Column
+	}
+
+	if other.End > s.End {
+		s.End = other.End
+	}
+
+	return s
 }
@@ -0,0 +1,98 @@
+package vm
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"golox/pkg/compiler"
+)
+
+// native is a function implemented in Go. An arity of -1 accepts any number
+// of arguments, and an error returned by fn becomes a runtime error.
+type native struct {
+	name  string
+	arity int
+	fn    func(args []interface{}) (interface{}, error)
+}
+
+func (n native) String() string {
+	return fmt.Sprintf("<native function %s>", n.name)
+}
+
+var clock = &native{"clock", 0, func(args []interface{}) (interface{}, error) {
+	return float64(time.Now().UnixMilli() / 1000), nil
+}}
+
+type upvalue struct {
+	location *interface{}
+	closed   interface{}
+	slot     int
+	next     *upvalue
+}
+
+type closure struct {
+	fn       *compiler.Function
+	upvalues []*upvalue
+}
+
+func (c closure) String() string {
+	if c.fn.Name == "" {
+		return "<function>"
+	}
+
+	return fmt.Sprintf("<function %s>", c.fn.Name)
+}
+
+type class struct {
+	name    string
+	methods map[string]*closure
+}
+
+func (c class) String() string {
+	return fmt.Sprintf("<class %s>", c.name)
+}
+
+type instance struct {
+	c      *class
+	fields map[string]interface{}
+}
+
+func (i instance) String() string {
+	return fmt.Sprintf("%s instance", i.c.name)
+}
+
+type boundMethod struct {
+	receiver interface{}
+	method   *closure
+}
+
+func (b boundMethod) String() string {
+	return b.method.String()
+}
+
+func isTruthy(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+
+	if boolean, ok := value.(bool); ok {
+		return boolean
+	}
+
+	return true
+}
+
+// Stringify formats a value the way print displays it.
+func Stringify(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,515 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"golox/pkg/compiler"
+	"golox/pkg/fault"
+)
+
+// framesMax matches interpreter.DEFAULT_MAX_DEPTH, so that both backends
+// run out of stack at the same depth. The frames and the value stack grow as
+// needed up to their maximum.
+const (
+	framesMax = 10000
+	stackMax  = framesMax * 256
+)
+
+type frame struct {
+	closure *closure
+	ip      int
+	base    int
+}
+
+// VM executes bytecode produced by the compiler package on a value stack
+// that grows as needed. Globals survive between calls to Interpret, which is
+// what the REPL relies on.
+type VM struct {
+	stack   []interface{}
+	sp      int
+	frames  []frame
+	fc      int
+	globals map[string]interface{}
+	open    *upvalue
+	out     io.Writer
+}
+
+func NewVM() *VM {
+	vm := &VM{stack: make([]interface{}, 256), frames: make([]frame, 64), globals: make(map[string]interface{}), out: os.Stdout}
+	vm.globals["clock"] = clock
+	return vm
+}
+
+// SetOutput redirects the output of print statements, which goes to
+// os.Stdout by default.
+func (vm *VM) SetOutput(w io.Writer) {
+	vm.out = w
+}
+
+// DefineNative makes a Go function available to Lox code as a global. An
+// arity of -1 accepts any number of arguments, and an error returned by fn
+// becomes a runtime error at the call.
+func (vm *VM) DefineNative(name string, arity int, fn func(args []interface{}) (interface{}, error)) {
+	vm.globals[name] = &native{name, arity, fn}
+}
+
+// Global returns the value of a global variable and whether it exists.
+func (vm *VM) Global(name string) (interface{}, bool) {
+	value, ok := vm.globals[name]
+	return value, ok
+}
+
+// Globals returns the names of the global variables in alphabetical order.
+func (vm *VM) Globals() []string {
+	names := make([]string, 0, len(vm.globals))
+	for name := range vm.globals {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (vm *VM) Interpret(fn *compiler.Function) error {
+	_, err := vm.Eval(fn)
+	return err
+}
+
+// Eval runs a compiled script like Interpret and returns the value the
+// script returns, which is that of its final expression statement.
+func (vm *VM) Eval(fn *compiler.Function) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(*fault.Fault)
+			if !ok {
+				panic(r)
+			}
+			vm.reset()
+			value, err = nil, f
+		}
+	}()
+
+	c := &closure{fn, nil}
+	vm.push(c)
+	vm.call(c, 0)
+	vm.run()
+	return vm.pop(), nil
+}
+
+func (vm *VM) reset() {
+	for i := 0; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = 0
+	vm.fc = 0
+	vm.open = nil
+}
+
+func (vm *VM) run() {
+	f := &vm.frames[vm.fc-1]
+	code := f.closure.fn.Chunk.Code
+	constants := f.closure.fn.Chunk.Constants
+
+	readShort := func() int {
+		f.ip += 2
+		return int(code[f.ip-2])<<8 | int(code[f.ip-1])
+	}
+
+	for {
+		op := compiler.OpCode(code[f.ip])
+		f.ip++
+
+		switch op {
+		case compiler.OP_CONSTANT:
+			vm.push(constants[readShort()])
+		case compiler.OP_NIL:
+			vm.push(nil)
+		case compiler.OP_TRUE:
+			vm.push(true)
+		case compiler.OP_FALSE:
+			vm.push(false)
+		case compiler.OP_POP:
+			vm.pop()
+		case compiler.OP_GET_LOCAL:
+			slot := int(code[f.ip])
+			f.ip++
+			vm.push(vm.stack[f.base+slot])
+		case compiler.OP_SET_LOCAL:
+			slot := int(code[f.ip])
+			f.ip++
+			vm.stack[f.base+slot] = vm.peek(0)
+		case compiler.OP_GET_GLOBAL:
+			name := constants[readShort()].(string)
+			value, ok := vm.globals[name]
+			if !ok {
+				panic(vm.error(fmt.Sprintf("undefined variable %s", name)))
+			}
+			vm.push(value)
+		case compiler.OP_DEFINE_GLOBAL:
+			name := constants[readShort()].(string)
+			vm.globals[name] = vm.pop()
+		case compiler.OP_SET_GLOBAL:
+			name := constants[readShort()].(string)
+			if _, ok := vm.globals[name]; !ok {
+				panic(vm.error(fmt.Sprintf("undefined variable %s", name)))
+			}
+			vm.globals[name] = vm.peek(0)
+		case compiler.OP_GET_UPVALUE:
+			slot := int(code[f.ip])
+			f.ip++
+			vm.push(*f.closure.upvalues[slot].location)
+		case compiler.OP_SET_UPVALUE:
+			slot := int(code[f.ip])
+			f.ip++
+			*f.closure.upvalues[slot].location = vm.peek(0)
+		case compiler.OP_GET_PROPERTY:
+			name := constants[readShort()].(string)
+			inst, ok := vm.peek(0).(*instance)
+			if !ok {
+				panic(vm.error("only instances have properties"))
+			}
+
+			if value, ok := inst.fields[name]; ok {
+				vm.pop()
+				vm.push(value)
+			} else {
+				vm.bindMethod(inst.c, name)
+			}
+		case compiler.OP_SET_PROPERTY:
+			name := constants[readShort()].(string)
+			inst, ok := vm.peek(1).(*instance)
+			if !ok {
+				panic(vm.error("only instances have fields"))
+			}
+
+			value := vm.pop()
+			inst.fields[name] = value
+			vm.pop()
+			vm.push(value)
+		case compiler.OP_GET_SUPER:
+			name := constants[readShort()].(string)
+			super := vm.pop().(*class)
+			method, ok := super.methods[name]
+			if !ok {
+				panic(vm.error(fmt.Sprintf("undefined property '%s'", name)))
+			}
+			vm.push(&boundMethod{vm.pop(), method})
+		case compiler.OP_EQUAL:
+			right := vm.pop()
+			left := vm.pop()
+			vm.push(left == right)
+		case compiler.OP_GREATER:
+			left, right := vm.numberOperands()
+			vm.push(left > right)
+		case compiler.OP_GREATER_EQUAL:
+			left, right := vm.numberOperands()
+			vm.push(left >= right)
+		case compiler.OP_LESS:
+			left, right := vm.numberOperands()
+			vm.push(left < right)
+		case compiler.OP_LESS_EQUAL:
+			left, right := vm.numberOperands()
+			vm.push(left <= right)
+		case compiler.OP_ADD:
+			switch left := vm.peek(1).(type) {
+			case float64:
+				if right, ok := vm.peek(0).(float64); ok {
+					vm.sp -= 2
+					vm.push(left + right)
+					continue
+				}
+			case string:
+				if right, ok := vm.peek(0).(string); ok {
+					vm.sp -= 2
+					vm.push(left + right)
+					continue
+				}
+			}
+			panic(vm.error("operands must be two numbers or two strings"))
+		case compiler.OP_SUBTRACT:
+			left, right := vm.numberOperands()
+			vm.push(left - right)
+		case compiler.OP_MULTIPLY:
+			left, right := vm.numberOperands()
+			vm.push(left * right)
+		case compiler.OP_DIVIDE:
+			left, right := vm.numberOperands()
+			vm.push(left / right)
+		case compiler.OP_NOT:
+			vm.push(!isTruthy(vm.pop()))
+		case compiler.OP_NEGATE:
+			value, ok := vm.peek(0).(float64)
+			if !ok {
+				panic(vm.error("operand must be a number"))
+			}
+			vm.stack[vm.sp-1] = -value
+		case compiler.OP_PRINT:
+			fmt.Fprintln(vm.out, Stringify(vm.pop()))
+		case compiler.OP_JUMP:
+			offset := readShort()
+			f.ip += offset
+		case compiler.OP_JUMP_IF_FALSE:
+			offset := readShort()
+			if !isTruthy(vm.peek(0)) {
+				f.ip += offset
+			}
+		case compiler.OP_LOOP:
+			offset := readShort()
+			f.ip -= offset
+		case compiler.OP_CALL:
+			argc := int(code[f.ip])
+			f.ip++
+			vm.callValue(vm.peek(argc), argc)
+		case compiler.OP_INVOKE:
+			name := constants[readShort()].(string)
+			argc := int(code[f.ip])
+			f.ip++
+			vm.invoke(name, argc)
+		case compiler.OP_SUPER_INVOKE:
+			name := constants[readShort()].(string)
+			argc := int(code[f.ip])
+			f.ip++
+			super := vm.pop().(*class)
+			method, ok := super.methods[name]
+			if !ok {
+				panic(vm.error(fmt.Sprintf("undefined property '%s'", name)))
+			}
+			vm.call(method, argc)
+		case compiler.OP_CLOSURE:
+			fn := constants[readShort()].(*compiler.Function)
+			c := &closure{fn, make([]*upvalue, fn.Upvalues)}
+			for i := range c.upvalues {
+				isLocal := code[f.ip] == 1
+				index := int(code[f.ip+1])
+				f.ip += 2
+				if isLocal {
+					c.upvalues[i] = vm.capture(f.base + index)
+				} else {
+					c.upvalues[i] = f.closure.upvalues[index]
+				}
+			}
+			vm.push(c)
+		case compiler.OP_CLOSE_UPVALUE:
+			vm.close(vm.sp - 1)
+			vm.pop()
+		case compiler.OP_RETURN:
+			result := vm.pop()
+			vm.close(f.base)
+			for i := f.base; i < vm.sp; i++ {
+				vm.stack[i] = nil
+			}
+			vm.sp = f.base
+			vm.fc--
+			vm.push(result)
+			if vm.fc == 0 {
+				return
+			}
+		case compiler.OP_CLASS:
+			name := constants[readShort()].(string)
+			vm.push(&class{name, make(map[string]*closure)})
+		case compiler.OP_INHERIT:
+			name := constants[readShort()].(string)
+			super, ok := vm.peek(1).(*class)
+			if !ok {
+				panic(vm.error(fmt.Sprintf("%s is a not a class", name)))
+			}
+
+			sub := vm.peek(0).(*class)
+			for name, method := range super.methods {
+				sub.methods[name] = method
+			}
+			vm.pop()
+		case compiler.OP_METHOD:
+			name := constants[readShort()].(string)
+			method := vm.peek(0).(*closure)
+			c := vm.peek(1).(*class)
+			c.methods[name] = method
+			vm.pop()
+		default:
+			panic(vm.error(fmt.Sprintf("unknown opcode %s", op)))
+		}
+
+		// calls and returns change the active frame
+		if op == compiler.OP_CALL || op == compiler.OP_INVOKE || op == compiler.OP_SUPER_INVOKE || op == compiler.OP_RETURN {
+			f = &vm.frames[vm.fc-1]
+			code = f.closure.fn.Chunk.Code
+			constants = f.closure.fn.Chunk.Constants
+		}
+	}
+}
+
+func (vm *VM) callValue(callee interface{}, argc int) {
+	switch c := callee.(type) {
+	case *closure:
+		vm.call(c, argc)
+	case *boundMethod:
+		vm.stack[vm.sp-argc-1] = c.receiver
+		vm.call(c.method, argc)
+	case *class:
+		vm.stack[vm.sp-argc-1] = &instance{c, make(map[string]interface{})}
+		if initializer, ok := c.methods["init"]; ok {
+			vm.call(initializer, argc)
+		} else if argc != 0 {
+			panic(vm.error(fmt.Sprintf("expected 0 arguments but got %d", argc)))
+		}
+	case *native:
+		if c.arity >= 0 && argc != c.arity {
+			panic(vm.error(fmt.Sprintf("expected %d arguments but got %d", c.arity, argc)))
+		}
+
+		result, err := c.fn(vm.stack[vm.sp-argc : vm.sp])
+		if err != nil {
+			panic(vm.error(err.Error()))
+		}
+		vm.sp -= argc + 1
+		vm.push(result)
+	default:
+		panic(vm.error("can only call functions and classes"))
+	}
+}
+
+func (vm *VM) call(c *closure, argc int) {
+	if argc != c.fn.Arity {
+		panic(vm.error(fmt.Sprintf("expected %d arguments but got %d", c.fn.Arity, argc)))
+	}
+
+	if vm.fc == framesMax {
+		panic(vm.error("stack overflow"))
+	}
+	if vm.fc == len(vm.frames) {
+		vm.frames = append(vm.frames, make([]frame, len(vm.frames))...)
+	}
+
+	vm.frames[vm.fc] = frame{c, 0, vm.sp - argc - 1}
+	vm.fc++
+}
+
+func (vm *VM) invoke(name string, argc int) {
+	inst, ok := vm.peek(argc).(*instance)
+	if !ok {
+		panic(vm.error("only instances have properties"))
+	}
+
+	if value, ok := inst.fields[name]; ok {
+		vm.stack[vm.sp-argc-1] = value
+		vm.callValue(value, argc)
+		return
+	}
+
+	method, ok := inst.c.methods[name]
+	if !ok {
+		panic(vm.error(fmt.Sprintf("undefined property %s", name)))
+	}
+	vm.call(method, argc)
+}
+
+func (vm *VM) bindMethod(c *class, name string) {
+	method, ok := c.methods[name]
+	if !ok {
+		panic(vm.error(fmt.Sprintf("undefined property %s", name)))
+	}
+
+	vm.stack[vm.sp-1] = &boundMethod{vm.peek(0), method}
+}
+
+func (vm *VM) capture(slot int) *upvalue {
+	var prev *upvalue
+	up := vm.open
+	for up != nil && up.slot > slot {
+		prev = up
+		up = up.next
+	}
+
+	if up != nil && up.slot == slot {
+		return up
+	}
+
+	created := &upvalue{&vm.stack[slot], nil, slot, up}
+	if prev == nil {
+		vm.open = created
+	} else {
+		prev.next = created
+	}
+
+	return created
+}
+
+func (vm *VM) close(last int) {
+	for vm.open != nil && vm.open.slot >= last {
+		up := vm.open
+		up.closed = *up.location
+		up.location = &up.closed
+		vm.open = up.next
+	}
+}
+
+func (vm *VM) numberOperands() (float64, float64) {
+	if left, ok := vm.peek(1).(float64); ok {
+		if right, ok := vm.peek(0).(float64); ok {
+			vm.sp -= 2
+			return left, right
+		}
+	}
+
+	panic(vm.error("operands must be numbers"))
+}
+
+func (vm *VM) push(value interface{}) {
+	if vm.sp == stackMax {
+		panic(vm.error("stack overflow"))
+	}
+	if vm.sp == len(vm.stack) {
+		vm.grow()
+	}
+
+	vm.stack[vm.sp] = value
+	vm.sp++
+}
+
+// grow doubles the value stack and moves the open upvalues, which point into
+// it, to the new one.
+func (vm *VM) grow() {
+	size := min(2*len(vm.stack), stackMax)
+	vm.stack = append(vm.stack, make([]interface{}, size-len(vm.stack))...)
+	for up := vm.open; up != nil; up = up.next {
+		up.location = &vm.stack[up.slot]
+	}
+}
+
+func (vm *VM) pop() interface{} {
+	vm.sp--
+	value := vm.stack[vm.sp]
+	vm.stack[vm.sp] = nil
+	return value
+}
+
+func (vm *VM) peek(distance int) interface{} {
+	return vm.stack[vm.sp-1-distance]
+}
+
+func (vm *VM) error(message string) error {
+	line := 0
+	if vm.fc > 0 {
+		f := &vm.frames[vm.fc-1]
+		line = f.closure.fn.Chunk.Lines[f.ip-1]
+	}
+
+	err := fault.NewFault(line, message)
+	err.Trace = []fault.Frame{}
+	for i := vm.fc - 1; i >= 0; i-- {
+		f := &vm.frames[i]
+		name := f.closure.fn.Name
+		if i == 0 {
+			name = "<script>"
+		} else if name == "" {
+			name = "<anonymous>"
+		}
+
+		err.Trace = append(err.Trace, fault.Frame{Function: name, Line: f.closure.fn.Chunk.Lines[f.ip-1]})
+	}
+
+	return err
+}
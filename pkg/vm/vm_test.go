@@ -0,0 +1,86 @@
+package vm_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golox/pkg/compiler"
+	"golox/pkg/interpreter"
+	"golox/pkg/parser"
+	"golox/pkg/resolver"
+	"golox/pkg/vm"
+)
+
+// TestBackends runs every testdata/*.lox script on the tree interpreter and
+// on the VM and checks that both print the same.
+func TestBackends(t *testing.T) {
+	scripts, err := filepath.Glob(filepath.Join("testdata", "*.lox"))
+	if err != nil || len(scripts) == 0 {
+		t.Fatalf("no test scripts: %v", err)
+	}
+
+	for _, script := range scripts {
+		t.Run(filepath.Base(script), func(t *testing.T) {
+			src, err := os.ReadFile(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stmts, err := parser.ParseSource(string(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := resolver.NewResolver().Resolve(stmts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var tree bytes.Buffer
+			i := interpreter.NewInterpreter()
+			i.SetOutput(&tree)
+			if err := i.Interpret(stmts, res); err != nil {
+				t.Fatalf("tree interpreter: %v", err)
+			}
+
+			fn, err := compiler.NewCompiler().Compile(stmts, res)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var bytecode bytes.Buffer
+			v := vm.NewVM()
+			v.SetOutput(&bytecode)
+			if err := v.Interpret(fn); err != nil {
+				t.Fatalf("vm: %v", err)
+			}
+
+			if bytecode.String() != tree.String() {
+				t.Errorf("the VM printed\n%s\nbut the tree interpreter printed\n%s", bytecode.String(), tree.String())
+			}
+		})
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	stmts, err := parser.ParseSource("fun f(n) { return f(n + 1); } f(0);")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := resolver.NewResolver().Resolve(stmts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fn, err := compiler.NewCompiler().Compile(stmts, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vm.NewVM().Interpret(fn); err == nil {
+		t.Error("expected a stack overflow")
+	}
+}
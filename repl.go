@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/peterh/liner"
+
+	"golox/pkg/fault"
+	"golox/pkg/golox"
+	"golox/pkg/parser"
+	"golox/pkg/printer"
+	"golox/pkg/resolver"
+	"golox/pkg/scanner"
+)
+
+// repl is an interactive session. Lines starting with a colon are commands
+// to the REPL itself rather than Lox code, see commands. The resolver
+// remembers the globals of earlier inputs, to warn about references to
+// globals that were never declared.
+type repl struct {
+	line       *liner.State
+	history    string
+	newBackend func(exit func(status int)) backend
+	b          backend
+	resolver   *resolver.Resolver
+	timing     bool
+}
+
+var commands = []struct {
+	name string
+	args string
+	help string
+}{
+	{":ast", "code", "show the syntax tree of code"},
+	{":env", "", "list the global variables"},
+	{":help", "", "show this help"},
+	{":load", "file", "run a script in this session"},
+	{":quit", "", "leave the REPL"},
+	{":reset", "", "forget every definition and start over"},
+	{":time", "[code]", "time code, or the next input if code is left out"},
+	{":tokens", "code", "show the tokens of code"},
+}
+
+// runPrompt reads statements from stdin. Input that ends in the middle of a
+// statement is continued on the next line after a "..." prompt; two empty
+// lines in a row give up on it. The value of a bare expression is printed.
+// On terminals lines can be edited, keywords and globals completed with tab
+// and the history is kept in ~/.golox_history.
+func runPrompt(newBackend func(exit func(status int)) backend) int {
+	r := &repl{liner.NewLiner(), "", newBackend, nil, nil, false}
+	r.reset()
+	r.line.SetCtrlCAborts(true)
+	r.line.SetWordCompleter(r.complete)
+
+	// piped input is not worth remembering
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		r.history = historyPath()
+	}
+
+	if f, err := os.Open(r.history); err == nil {
+		r.line.ReadHistory(f)
+		f.Close()
+	}
+
+	err := r.loop()
+	r.close()
+
+	if err != nil && err != io.EOF {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_IO
+	}
+
+	fmt.Println("bye")
+	return EXIT_OK
+}
+
+// loop reads input until :quit or the end of stdin, which it reports as
+// io.EOF.
+func (r *repl) loop() error {
+	src, blank := "", false
+	for {
+		prompt := "> "
+		if src != "" {
+			prompt = "... "
+		}
+
+		line, err := r.line.Prompt(prompt)
+		if err == liner.ErrPromptAborted {
+			src, blank = "", false
+			continue
+		} else if err != nil {
+			if err == io.EOF && src != "" {
+				stmts, perr := golox.Parse(src)
+				r.evaluate(src, stmts, perr)
+			}
+			return err
+		}
+
+		if strings.TrimSpace(line) != "" {
+			r.line.AppendHistory(line)
+		}
+
+		if src == "" && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if !r.command(strings.TrimSpace(line)) {
+				return nil
+			}
+			continue
+		}
+
+		if src != "" {
+			src += "\n"
+		}
+		src += line
+
+		stmts, err := golox.Parse(src)
+		if err != nil && incomplete(src, err) && !(blank && line == "") {
+			blank = line == ""
+			continue
+		}
+
+		r.evaluate(src, stmts, err)
+		src, blank = "", false
+	}
+}
+
+// close saves the history and gives the terminal back.
+func (r *repl) close() {
+	if r.history != "" {
+		if f, err := os.Create(r.history); err == nil {
+			r.line.WriteHistory(f)
+			f.Close()
+		}
+	}
+	r.line.Close()
+}
+
+// exit ends the session for a script calling exit.
+func (r *repl) exit(status int) {
+	r.close()
+	os.Exit(status)
+}
+
+// reset starts the session over with a new backend.
+func (r *repl) reset() {
+	r.b = r.newBackend(r.exit)
+	r.resolver = resolver.NewResolver()
+	r.resolver.Remember(r.b.globals())
+}
+
+func (r *repl) evaluate(src string, stmts []parser.Stmt, err error) {
+	start := time.Now()
+	sources[""] = src
+	if err := r.run(stmts, err, echoes(stmts)); err != nil {
+		reporter.Report(fault.Diagnostics(err))
+	}
+
+	if r.timing {
+		fmt.Printf("took %s\n", time.Since(start))
+		r.timing = false
+	}
+}
+
+// command runs a REPL command and reports whether the session goes on.
+func (r *repl) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case ":ast":
+		stmts, err := parseSnippet(arg)
+		if err != nil {
+			reporter.Report(fault.Diagnostics(err))
+			break
+		}
+		fmt.Print(printer.Print(stmts))
+	case ":env":
+		for _, name := range r.b.globals() {
+			fmt.Printf("%s = %s\n", name, r.b.global(name))
+		}
+	case ":help":
+		for _, c := range commands {
+			fmt.Printf("%-16s %s\n", strings.TrimSpace(c.name+" "+c.args), c.help)
+		}
+	case ":load":
+		r.load(arg)
+	case ":quit":
+		return false
+	case ":reset":
+		r.reset()
+	case ":time":
+		r.timing = true
+		if arg != "" {
+			stmts, err := parseSnippet(arg)
+			r.evaluate(arg, stmts, err)
+		}
+	case ":tokens":
+		sources[""] = arg
+		if err := printTokens(arg); err != nil {
+			reporter.Report(fault.Diagnostics(err))
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s, see :help\n", name)
+	}
+
+	return true
+}
+
+// load runs a script in the session, so that its globals stay defined.
+func (r *repl) load(path string) {
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "usage: :load file")
+		return
+	}
+
+	bytes, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	stmts, err := golox.Parse(string(bytes))
+	if err := r.run(stmts, err, false); err != nil {
+		reporter.Report(fault.Diagnostics(err).InFile(path))
+	}
+}
+
+// run resolves and runs stmts unless parsing them failed with err. Warnings
+// are reported before the program runs.
+func (r *repl) run(stmts []parser.Stmt, err error, echo bool) error {
+	if err != nil {
+		return err
+	}
+
+	res, err := r.resolver.Resolve(stmts)
+	if err != nil {
+		return err
+	}
+
+	if len(res.Warnings) > 0 {
+		reporter.Report(res.Warnings)
+	}
+
+	_, err = r.b.run(stmts, res, echo)
+	return err
+}
+
+// complete completes the word before the cursor with a command name at the
+// start of the line, or else with a keyword or global variable.
+func (r *repl) complete(line string, pos int) (string, []string, string) {
+	start := pos
+	for start > 0 && isWordByte(line[start-1]) {
+		start--
+	}
+
+	word := line[start:pos]
+	candidates := append(scanner.Keywords(), r.b.globals()...)
+	if start > 0 && line[start-1] == ':' && strings.TrimSpace(line[:start-1]) == "" {
+		start--
+		word = ":" + word
+		candidates = candidates[:0]
+		for _, c := range commands {
+			candidates = append(candidates, c.name)
+		}
+	}
+
+	completions := []string{}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			completions = append(completions, candidate)
+		}
+	}
+
+	return line[:start], completions, line[pos:]
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// historyPath returns where the REPL keeps the lines entered in earlier
+// sessions.
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".golox_history"
+	}
+
+	return filepath.Join(home, ".golox_history")
+}
+
+// parseSnippet parses code given to a command, adding the semicolon that a
+// single expression typed there usually lacks.
+func parseSnippet(src string) ([]parser.Stmt, error) {
+	stmts, err := golox.Parse(src)
+	if err != nil {
+		if fixed, ferr := golox.Parse(src + ";"); ferr == nil {
+			return fixed, nil
+		}
+	}
+
+	return stmts, err
+}
+
+// incomplete reports whether src failed to parse only because it ended too
+// early, such as in an unterminated string or before a closing brace or
+// semicolon.
+func incomplete(src string, err error) bool {
+	for _, d := range fault.Diagnostics(err) {
+		if d.Code != fault.UNTERMINATED_STRING && d.Span.Start < len(src) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// echoes reports whether the REPL should print the value of stmts, which is
+// the case when they end in an expression other than an assignment.
+func echoes(stmts []parser.Stmt) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+
+	e, ok := stmts[len(stmts)-1].(*parser.ExprStmt)
+	if !ok {
+		return false
+	}
+
+	switch e.Expression.(type) {
+	case *parser.AssignExpr, *parser.SetExpr, *parser.IndexSetExpr:
+		return false
+	}
+
+	return true
+}